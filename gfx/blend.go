@@ -0,0 +1,64 @@
+package gfx
+
+import "image/color"
+
+// Blend modes for OpSetBlendMode, which decide how drawing operations combine the drawing
+// color with the pixels already on the target.
+const (
+	BlendReplace  = 0 // Replace the pixel with the color.
+	BlendOver     = 1 // Composite the color over the pixel according to its alpha.
+	BlendAdd      = 2 // Add the color to the pixel, saturating at 255.
+	BlendMultiply = 3 // Multiply the pixel by the color.
+	BlendXOR      = 4 // XOR an opaque pixel with the color, keeping others; drawing twice restores any pixel.
+)
+
+// Blend returns the pixel dst after drawing src over it in the given blend mode. Both
+// colors are alpha-premultiplied. Unknown modes behave like BlendReplace.
+//
+// BlendXOR only changes opaque pixels, as XORing any other pixel could not be undone
+// without leaving an invalid premultiplied color or an opaque one over the layers beneath
+// the canvas. To XOR over transparent pixels, such as over the tilemap, carts use the
+// indexed mode, where BlendIndex XORs palette indices.
+//
+// Blend only uses integer math, so that the result is the same on every machine.
+func Blend(dst, src color.RGBA, mode byte) color.RGBA {
+	switch mode {
+	case BlendOver:
+		f := 255 - uint32(src.A)
+		over := func(d, s uint8) uint8 {
+			return s + uint8((uint32(d)*f+127)/255)
+		}
+		return color.RGBA{over(dst.R, src.R), over(dst.G, src.G), over(dst.B, src.B), over(dst.A, src.A)}
+	case BlendAdd:
+		add := func(d, s uint8) uint8 {
+			return uint8(min(uint32(d)+uint32(s), 255))
+		}
+		return color.RGBA{add(dst.R, src.R), add(dst.G, src.G), add(dst.B, src.B), add(dst.A, src.A)}
+	case BlendMultiply:
+		mul := func(d, s uint8) uint8 {
+			return uint8((uint32(d)*uint32(s) + 127) / 255)
+		}
+		return color.RGBA{mul(dst.R, src.R), mul(dst.G, src.G), mul(dst.B, src.B), mul(dst.A, src.A)}
+	case BlendXOR:
+		if dst.A != 255 {
+			return dst
+		}
+		return color.RGBA{dst.R ^ src.R, dst.G ^ src.G, dst.B ^ src.B, 255}
+	}
+	return src
+}
+
+// BlendIndex is like Blend, for palette indices in the indexed mode: BlendXOR XORs the
+// indices, BlendOver keeps dst when the palette color of src is fully transparent, and
+// every other mode replaces dst with src.
+func BlendIndex(dst, src byte, palette *[256]color.RGBA, mode byte) byte {
+	switch mode {
+	case BlendXOR:
+		return dst ^ src
+	case BlendOver:
+		if palette[src].A == 0 {
+			return dst
+		}
+	}
+	return src
+}
@@ -0,0 +1,67 @@
+package gfx
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestBlend(t *testing.T) {
+	dst := color.RGBA{200, 100, 0, 255}
+	half := color.RGBA{50, 0, 100, 128} // Premultiplied
+
+	table := []struct {
+		name     string
+		dst, src color.RGBA
+		mode     byte
+		want     color.RGBA
+	}{
+		{name: "replace", dst: dst, src: half, mode: BlendReplace, want: half},
+		{name: "over", dst: dst, src: half, mode: BlendOver, want: color.RGBA{150, 50, 100, 255}},
+		{name: "over opaque", dst: dst, src: color.RGBA{1, 2, 3, 255}, mode: BlendOver, want: color.RGBA{1, 2, 3, 255}},
+		{name: "over transparent", dst: dst, src: color.RGBA{}, mode: BlendOver, want: dst},
+		{name: "add", dst: dst, src: half, mode: BlendAdd, want: color.RGBA{250, 100, 100, 255}},
+		{name: "add saturates", dst: dst, src: color.RGBA{100, 0, 0, 255}, mode: BlendAdd, want: color.RGBA{255, 100, 0, 255}},
+		{name: "multiply", dst: dst, src: color.RGBA{255, 128, 0, 255}, mode: BlendMultiply, want: color.RGBA{200, 50, 0, 255}},
+		{name: "xor", dst: dst, src: color.RGBA{255, 255, 255, 255}, mode: BlendXOR, want: color.RGBA{55, 155, 255, 255}},
+		{name: "xor transparent", dst: color.RGBA{}, src: color.RGBA{1, 2, 3, 255}, mode: BlendXOR, want: color.RGBA{}},
+		{name: "xor translucent", dst: half, src: color.RGBA{1, 2, 3, 255}, mode: BlendXOR, want: half},
+		{name: "unknown", dst: dst, src: half, mode: 99, want: half},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Blend(test.dst, test.src, test.mode); got != test.want {
+				t.Errorf("Blend(%v, %v, %d) = %v, want %v", test.dst, test.src, test.mode, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBlendXORReverses(t *testing.T) {
+	for _, dst := range []color.RGBA{{0, 0, 0, 255}, {200, 100, 7, 255}, {}, {50, 0, 100, 128}} {
+		src := color.RGBA{123, 45, 67, 255}
+		if got := Blend(Blend(dst, src, BlendXOR), src, BlendXOR); got != dst {
+			t.Errorf("XORing %v twice over %v = %v, want %v", src, dst, got, dst)
+		}
+	}
+}
+
+func TestBlendIndex(t *testing.T) {
+	palette := DefaultPalette
+	palette[9] = color.RGBA{}
+
+	table := []struct {
+		dst, src, mode, want byte
+	}{
+		{dst: 3, src: 5, mode: BlendReplace, want: 5},
+		{dst: 3, src: 5, mode: BlendOver, want: 5},
+		{dst: 3, src: 9, mode: BlendOver, want: 3},
+		{dst: 3, src: 5, mode: BlendAdd, want: 5},
+		{dst: 3, src: 5, mode: BlendXOR, want: 6},
+	}
+	for _, test := range table {
+		if got := BlendIndex(test.dst, test.src, &palette, test.mode); got != test.want {
+			t.Errorf("BlendIndex(%d, %d, mode %d) = %d, want %d", test.dst, test.src, test.mode, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gfx
+
+// The size of a Console in characters.
+const (
+	ConsoleCols = 32
+	ConsoleRows = 24
+)
+
+// Console is a text display of ConsoleCols by ConsoleRows characters, drawn with the
+// built-in Font. Characters are written at the cursor, which moves on to the right and
+// then to the next line. Writing past the last line scrolls the text up by a line.
+//
+// The zero value is an empty console with the cursor in the top-left corner.
+type Console struct {
+	Cells [ConsoleRows][ConsoleCols]byte // Characters by row and column; 0 is blank.
+	X, Y  int                            // The cursor position, in characters.
+}
+
+// Write writes every byte of p to the console with WriteByte. It never fails, so that the
+// console can be the output of a program.
+func (c *Console) Write(p []byte) (n int, err error) {
+	for _, b := range p {
+		c.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+// WriteByte writes the character b at the cursor. The control characters '\n' (new line),
+// '\r' (carriage return), '\b' (backspace), '\t' (tab to a multiple of 4 columns) and
+// '\f' (form feed, which clears the console) move the cursor instead.
+func (c *Console) WriteByte(b byte) error {
+	switch b {
+	case '\n':
+		c.newline()
+	case '\r':
+		c.X = 0
+	case '\b':
+		if c.X > 0 {
+			c.X--
+			c.Cells[c.Y][c.X] = 0
+		}
+	case '\t':
+		c.X = (c.X/4 + 1) * 4
+		if c.X >= ConsoleCols {
+			c.newline()
+		}
+	case '\f':
+		c.Clear()
+	default:
+		c.Cells[c.Y][c.X] = b
+		c.X++
+		if c.X >= ConsoleCols {
+			c.newline()
+		}
+	}
+	return nil
+}
+
+// SetCursor moves the cursor to column x of row y, which are clamped to the console.
+func (c *Console) SetCursor(x, y int) {
+	c.X = max(0, min(x, ConsoleCols-1))
+	c.Y = max(0, min(y, ConsoleRows-1))
+}
+
+// Clear blanks every character and moves the cursor to the top-left corner.
+func (c *Console) Clear() {
+	*c = Console{}
+}
+
+// newline moves the cursor to the start of the next line, scrolling the text up a line if
+// the cursor is on the last one.
+func (c *Console) newline() {
+	c.X = 0
+	if c.Y < ConsoleRows-1 {
+		c.Y++
+		return
+	}
+	copy(c.Cells[:], c.Cells[1:])
+	c.Cells[ConsoleRows-1] = [ConsoleCols]byte{}
+}
+
+// Draw calls plot for every pixel of the console with its top-left corner at (0, 0), with
+// true for the pixels of characters and false for the background. The cell of the cursor
+// is drawn inverted, so that it shows even when the bottom row of pixels does not fit on
+// the canvas, as on the default 255x191 one.
+func (c *Console) Draw(plot func(x, y int, fg bool)) {
+	for row := range ConsoleRows {
+		for col := range ConsoleCols {
+			var glyph [8]byte
+			if ch := c.Cells[row][col]; ch != 0 {
+				glyph = Glyph(ch)
+			}
+			if row == c.Y && col == c.X {
+				for y := range glyph {
+					glyph[y] = ^glyph[y]
+				}
+			}
+			for y, bits := range glyph {
+				for x := range 8 {
+					plot(col*8+x, row*8+y, bits&(1<<x) != 0)
+				}
+			}
+		}
+	}
+}
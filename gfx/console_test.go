@@ -0,0 +1,70 @@
+package gfx
+
+import (
+	"strings"
+	"testing"
+)
+
+// lines returns the text of the console, with blanks as '.', and trailing blank lines removed.
+func lines(c *Console) string {
+	var sb strings.Builder
+	for _, row := range c.Cells {
+		for _, ch := range row {
+			if ch == 0 {
+				ch = '.'
+			}
+			sb.WriteByte(ch)
+		}
+		sb.WriteByte('\n')
+	}
+	blank := strings.Repeat(".", ConsoleCols) + "\n"
+	s := sb.String()
+	for strings.HasSuffix(s, blank) {
+		s = strings.TrimSuffix(s, blank)
+	}
+	return s
+}
+
+func TestConsole(t *testing.T) {
+	pad := func(s string) string {
+		return s + strings.Repeat(".", ConsoleCols-len(s)) + "\n"
+	}
+
+	table := []struct {
+		name         string
+		input        string
+		want         string
+		wantX, wantY int
+	}{
+		{name: "text", input: "Hi\nyou", want: pad("Hi") + pad("you"), wantX: 3, wantY: 1},
+		{name: "carriage return", input: "abc\rX", want: pad("Xbc"), wantX: 1},
+		{name: "backspace", input: "ab\b\bc", want: pad("c"), wantX: 1},
+		{name: "tab", input: "a\tb", want: pad("a...b"), wantX: 5},
+		{name: "form feed", input: "abc\n\fd", want: pad("d"), wantX: 1},
+		{
+			name:  "wrap",
+			input: strings.Repeat("x", ConsoleCols) + "y",
+			want:  strings.Repeat("x", ConsoleCols) + "\n" + pad("y"),
+			wantX: 1, wantY: 1,
+		},
+		{
+			name:  "scroll",
+			input: "top" + strings.Repeat("\n", ConsoleRows-1) + "bottom\nend",
+			want:  strings.Repeat(pad(""), ConsoleRows-2) + pad("bottom") + pad("end"),
+			wantX: 3, wantY: ConsoleRows - 1,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var c Console
+			c.Write([]byte(test.input))
+			if got := lines(&c); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+			if c.X != test.wantX || c.Y != test.wantY {
+				t.Errorf("cursor = (%d, %d), want (%d, %d)", c.X, c.Y, test.wantX, test.wantY)
+			}
+		})
+	}
+}
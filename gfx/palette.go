@@ -0,0 +1,28 @@
+package gfx
+
+import "image/color"
+
+// DefaultPalette holds the colors that palette indices refer to until a program changes
+// them. The first 16 entries are the Commodore 64 colors, so small indices such as the
+// pixels of 1-bit and 2-bit sprites start with black, white, red and cyan. They are
+// followed by a 6x6x6 color cube and a 24 step grayscale ramp.
+var DefaultPalette = func() (p [256]color.RGBA) {
+	c64 := [16]uint32{
+		0x000000, 0xFFFFFF, 0x68372B, 0x70A4B2, 0x6F3D86, 0x588D43, 0x352879, 0xB8C76F,
+		0x6F4F25, 0x433900, 0x9A6759, 0x444444, 0x6C6C6C, 0x9AD284, 0x6C5EB5, 0x959595,
+	}
+	for i, rgb := range c64 {
+		p[i] = color.RGBA{byte(rgb >> 16), byte(rgb >> 8), byte(rgb), 255}
+	}
+
+	levels := [6]byte{0, 95, 135, 175, 215, 255}
+	for i := range 216 {
+		p[16+i] = color.RGBA{levels[i/36], levels[i/6%6], levels[i%6], 255}
+	}
+
+	for i := range 24 {
+		v := byte(8 + 10*i)
+		p[232+i] = color.RGBA{v, v, v, 255}
+	}
+	return p
+}()
@@ -0,0 +1,312 @@
+// Package gfx is the software rasterizer behind bf8's drawing opcodes.
+//
+// Every shape is reduced to a sequence of integer pixel coordinates by the functions in
+// this package, so a cart draws exactly the same pixels regardless of the machine or the
+// version of the graphics library presenting the canvas.
+package gfx
+
+import (
+	"image"
+	"math"
+	"slices"
+)
+
+// Line calls plot for every pixel of the line from (x1, y1) to (x2, y2), endpoints
+// included, using Bresenham's algorithm.
+func Line(x1, y1, x2, y2 int, plot func(x, y int)) {
+	dx := abs(x2 - x1)
+	dy := -abs(y2 - y1)
+	sx, sy := sign(x2-x1), sign(y2-y1)
+
+	err := dx + dy
+	for {
+		plot(x1, y1)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+// FillPolygon calls plot for every pixel inside the polygon with the given vertices that
+// lies within bounds, using the even-odd rule so that the overlapping parts of a
+// self-intersecting polygon are left empty. Like FillTriangle, the filled area covers the
+// pixels of the edges drawn by Line, and every pixel is plotted exactly once.
+func FillPolygon(vertices []image.Point, bounds image.Rectangle, plot func(x, y int)) {
+	if len(vertices) == 0 {
+		return
+	}
+
+	// Only the part of the polygon within bounds is filled in
+	box := image.Rectangle{Min: vertices[0], Max: vertices[0].Add(image.Pt(1, 1))}
+	for _, v := range vertices[1:] {
+		box = box.Union(image.Rectangle{Min: v, Max: v.Add(image.Pt(1, 1))})
+	}
+	box = box.Intersect(bounds)
+	if box.Empty() {
+		return
+	}
+	covered := make([]bool, box.Dx()*box.Dy())
+	cover := func(x, y int) {
+		if image.Pt(x, y).In(box) {
+			covered[(y-box.Min.Y)*box.Dx()+x-box.Min.X] = true
+		}
+	}
+
+	var crossings []int
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		// Find where the edges cross the row. Each edge includes its upper end but not
+		// its lower end, so a vertex shared by two edges is only counted once.
+		crossings = crossings[:0]
+		for i, a := range vertices {
+			b := vertices[(i+1)%len(vertices)]
+			if (a.Y <= y && y < b.Y) || (b.Y <= y && y < a.Y) {
+				crossings = append(crossings, a.X+floorDiv((y-a.Y)*(b.X-a.X), b.Y-a.Y))
+			}
+		}
+		slices.Sort(crossings)
+
+		for i := 0; i+1 < len(crossings); i += 2 {
+			span(y, crossings[i], crossings[i+1], box, cover)
+		}
+	}
+	for i, a := range vertices {
+		b := vertices[(i+1)%len(vertices)]
+		Line(a.X, a.Y, b.X, b.Y, cover)
+	}
+
+	for i, c := range covered {
+		if c {
+			plot(box.Min.X+i%box.Dx(), box.Min.Y+i/box.Dx())
+		}
+	}
+}
+
+// FloodFill calls plot for every pixel of the area around (x, y) for which inside reports
+// true, as long as the pixels are within bounds. The area is 4-connected: it spreads
+// horizontally and vertically, but not diagonally. Every pixel is plotted exactly once,
+// and inside is called before a pixel is plotted.
+func FloodFill(x, y int, bounds image.Rectangle, inside func(x, y int) bool, plot func(x, y int)) {
+	visited := make([]bool, bounds.Dx()*bounds.Dy())
+	stack := []image.Point{{x, y}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !p.In(bounds) {
+			continue
+		}
+		i := (p.Y-bounds.Min.Y)*bounds.Dx() + p.X - bounds.Min.X
+		if visited[i] || !inside(p.X, p.Y) {
+			continue
+		}
+		visited[i] = true
+		plot(p.X, p.Y)
+
+		stack = append(stack,
+			image.Pt(p.X+1, p.Y), image.Pt(p.X-1, p.Y),
+			image.Pt(p.X, p.Y+1), image.Pt(p.X, p.Y-1))
+	}
+}
+
+// floorDiv returns a / b rounded towards negative infinity.
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Rect calls plot for every pixel on the outline of the rectangle with opposite corners
+// (x1, y1) and (x2, y2), both included. Every pixel is plotted exactly once.
+func Rect(x1, y1, x2, y2 int, plot func(x, y int)) {
+	x1, x2 = min(x1, x2), max(x1, x2)
+	y1, y2 = min(y1, y2), max(y1, y2)
+
+	for x := x1; x <= x2; x++ {
+		plot(x, y1)
+		if y2 != y1 {
+			plot(x, y2)
+		}
+	}
+	for y := y1 + 1; y < y2; y++ {
+		plot(x1, y)
+		if x2 != x1 {
+			plot(x2, y)
+		}
+	}
+}
+
+// FillRect calls plot for every pixel inside the rectangle with opposite corners (x1, y1)
+// and (x2, y2), both included, that lies within bounds.
+func FillRect(x1, y1, x2, y2 int, bounds image.Rectangle, plot func(x, y int)) {
+	x1, x2 = min(x1, x2), max(x1, x2)
+	y1, y2 = min(y1, y2), max(y1, y2)
+
+	for y := max(y1, bounds.Min.Y); y <= min(y2, bounds.Max.Y-1); y++ {
+		span(y, x1, x2, bounds, plot)
+	}
+}
+
+// span calls plot for every pixel of row y from x1 to x2, both included, that lies within
+// bounds. The filled shapes are drawn one span at a time, so that their size does not
+// matter when bounds is small.
+func span(y, x1, x2 int, bounds image.Rectangle, plot func(x, y int)) {
+	if y < bounds.Min.Y || y >= bounds.Max.Y {
+		return
+	}
+	for x := max(x1, bounds.Min.X); x <= min(x2, bounds.Max.X-1); x++ {
+		plot(x, y)
+	}
+}
+
+// Ellipse calls plot for every pixel on the outline of the ellipse centered on (cx, cy)
+// with the horizontal radius rx and vertical radius ry. A circle has rx == ry. Every
+// pixel is plotted exactly once.
+func Ellipse(cx, cy, rx, ry int, plot func(x, y int)) {
+	ellipseQuadrant(rx, ry, func(x, y int) {
+		plot(cx+x, cy+y)
+		if x != 0 {
+			plot(cx-x, cy+y)
+		}
+		if y != 0 {
+			plot(cx+x, cy-y)
+			if x != 0 {
+				plot(cx-x, cy-y)
+			}
+		}
+	})
+}
+
+// FillEllipse calls plot for every pixel inside the ellipse centered on (cx, cy) with the
+// horizontal radius rx and vertical radius ry that lies within bounds. The filled area
+// covers exactly the pixels of the outline drawn by Ellipse and everything within it.
+func FillEllipse(cx, cy, rx, ry int, bounds image.Rectangle, plot func(x, y int)) {
+	// The widest point of the quadrant on each row, indexed by the distance from cy.
+	halfWidths := make([]int, abs(ry)+1)
+	ellipseQuadrant(rx, ry, func(x, y int) {
+		halfWidths[y] = max(halfWidths[y], x)
+	})
+
+	for y, w := range halfWidths {
+		span(cy+y, cx-w, cx+w, bounds, plot)
+		if y != 0 {
+			span(cy-y, cx-w, cx+w, bounds, plot)
+		}
+	}
+}
+
+// ellipseQuadrant calls point for every pixel on the bottom-right quarter of the outline
+// of an ellipse centered on the origin, using the midpoint ellipse algorithm. Each point
+// is visited once, and x and y are never negative.
+func ellipseQuadrant(rx, ry int, point func(x, y int)) {
+	rx, ry = abs(rx), abs(ry)
+
+	// The algorithm below never terminates for a flat ellipse, which is simply a line.
+	if rx == 0 {
+		for y := ry; y >= 0; y-- {
+			point(0, y)
+		}
+		return
+	}
+	if ry == 0 {
+		for x := 0; x <= rx; x++ {
+			point(x, 0)
+		}
+		return
+	}
+
+	rx2, ry2 := rx*rx, ry*ry
+	x, y := 0, ry
+	px, py := 0, 2*rx2*y
+
+	// Region 1: the slope of the curve is shallower than -1, so x always advances.
+	p := ry2 - rx2*ry + rx2/4
+	for px < py {
+		point(x, y)
+		x++
+		px += 2 * ry2
+		if p < 0 {
+			p += ry2 + px
+		} else {
+			y--
+			py -= 2 * rx2
+			p += ry2 + px - py
+		}
+	}
+
+	// Region 2: the slope is steeper than -1, so y always advances.
+	p = ry2*(x*x+x) + rx2*(y-1)*(y-1) - rx2*ry2
+	for y >= 0 {
+		point(x, y)
+		y--
+		py -= 2 * rx2
+		if p > 0 {
+			p += rx2 - py
+		} else {
+			x++
+			px += 2 * ry2
+			p += rx2 - py + px
+		}
+	}
+}
+
+// FillTriangle calls plot for every pixel inside the triangle with the corners (x1, y1),
+// (x2, y2) and (x3, y3) that lies within bounds. The filled area covers exactly the pixels
+// of the three edges drawn by Line and everything between them, and every pixel is plotted
+// exactly once.
+func FillTriangle(x1, y1, x2, y2, x3, y3 int, bounds image.Rectangle, plot func(x, y int)) {
+	// Only the rows within bounds are filled in
+	top := max(min(y1, y2, y3), bounds.Min.Y)
+	rows := min(max(y1, y2, y3), bounds.Max.Y-1) - top + 1
+	if rows <= 0 {
+		return
+	}
+
+	// The leftmost and rightmost pixel of the edges on each row, indexed by y - top.
+	left := make([]int, rows)
+	right := make([]int, rows)
+	for i := range rows {
+		left[i] = math.MaxInt
+		right[i] = math.MinInt
+	}
+	edge := func(x, y int) {
+		if i := y - top; i >= 0 && i < rows {
+			left[i] = min(left[i], x)
+			right[i] = max(right[i], x)
+		}
+	}
+	Line(x1, y1, x2, y2, edge)
+	Line(x2, y2, x3, y3, edge)
+	Line(x3, y3, x1, y1, edge)
+
+	for i := range rows {
+		span(top+i, left[i], right[i], bounds, plot)
+	}
+}
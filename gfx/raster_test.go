@@ -0,0 +1,254 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLine(t *testing.T) {
+	table := []struct {
+		name           string
+		x1, y1, x2, y2 int
+		want           []image.Point
+	}{
+		{name: "point", x1: 3, y1: 3, x2: 3, y2: 3, want: pts(3, 3)},
+		{name: "horizontal", x1: 0, y1: 1, x2: 3, y2: 1, want: pts(0, 1, 1, 1, 2, 1, 3, 1)},
+		{name: "vertical up", x1: 2, y1: 3, x2: 2, y2: 0, want: pts(2, 3, 2, 2, 2, 1, 2, 0)},
+		{name: "diagonal", x1: 0, y1: 0, x2: 3, y2: 3, want: pts(0, 0, 1, 1, 2, 2, 3, 3)},
+		{name: "shallow", x1: 0, y1: 0, x2: 4, y2: 2, want: pts(0, 0, 1, 1, 2, 1, 3, 2, 4, 2)},
+		{name: "steep", x1: 0, y1: 0, x2: 1, y2: 4, want: pts(0, 0, 0, 1, 1, 2, 1, 3, 1, 4)},
+		{name: "reverse", x1: 4, y1: 2, x2: 0, y2: 0, want: pts(4, 2, 3, 1, 2, 1, 1, 0, 0, 0)},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var got []image.Point
+			Line(test.x1, test.y1, test.x2, test.y2, func(x, y int) {
+				got = append(got, image.Pt(x, y))
+			})
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShapes(t *testing.T) {
+	bounds := image.Rect(0, 0, 7, 5) // The whole grid
+	const full = "" +
+		"#######\n" +
+		"#######\n" +
+		"#######\n" +
+		"#######\n" +
+		"#######\n"
+
+	table := []struct {
+		name  string
+		shape func(plot func(x, y int))
+		want  string
+	}{
+		{
+			name:  "rect",
+			shape: func(plot func(x, y int)) { Rect(5, 3, 1, 1, plot) },
+			want: "" +
+				".......\n" +
+				".#####.\n" +
+				".#...#.\n" +
+				".#####.\n" +
+				".......\n",
+		},
+		{
+			name:  "fill rect",
+			shape: func(plot func(x, y int)) { FillRect(1, 1, 5, 2, bounds, plot) },
+			want: "" +
+				".......\n" +
+				".#####.\n" +
+				".#####.\n" +
+				".......\n" +
+				".......\n",
+		},
+		{
+			name:  "circle",
+			shape: func(plot func(x, y int)) { Ellipse(2, 2, 2, 2, plot) },
+			want: "" +
+				".###...\n" +
+				"#...#..\n" +
+				"#...#..\n" +
+				"#...#..\n" +
+				".###...\n",
+		},
+		{
+			name:  "ellipse",
+			shape: func(plot func(x, y int)) { Ellipse(3, 2, 3, 2, plot) },
+			want: "" +
+				"..###..\n" +
+				".#...#.\n" +
+				"#.....#\n" +
+				".#...#.\n" +
+				"..###..\n",
+		},
+		{
+			name:  "fill ellipse",
+			shape: func(plot func(x, y int)) { FillEllipse(3, 2, 3, 2, bounds, plot) },
+			want: "" +
+				"..###..\n" +
+				".#####.\n" +
+				"#######\n" +
+				".#####.\n" +
+				"..###..\n",
+		},
+		{
+			name:  "flat ellipse",
+			shape: func(plot func(x, y int)) { FillEllipse(3, 2, 2, 0, bounds, plot) },
+			want: "" +
+				".......\n" +
+				".......\n" +
+				".#####.\n" +
+				".......\n" +
+				".......\n",
+		},
+		{
+			name: "fill polygon",
+			shape: func(plot func(x, y int)) {
+				FillPolygon([]image.Point{{0, 0}, {6, 0}, {6, 4}, {3, 1}, {0, 4}}, bounds, plot)
+			},
+			want: "" +
+				"#######\n" +
+				"#######\n" +
+				"###.###\n" +
+				"##...##\n" +
+				"#.....#\n",
+		},
+		{
+			name: "fill self-intersecting polygon",
+			shape: func(plot func(x, y int)) {
+				FillPolygon([]image.Point{{0, 0}, {6, 4}, {6, 0}, {0, 4}}, bounds, plot)
+			},
+			want: "" +
+				"#.....#\n" +
+				"###.###\n" +
+				"#######\n" +
+				"###.###\n" +
+				"#.....#\n",
+		},
+		{
+			name:  "fill triangle",
+			shape: func(plot func(x, y int)) { FillTriangle(0, 0, 6, 2, 1, 4, bounds, plot) },
+			want: "" +
+				"##.....\n" +
+				"#####..\n" +
+				"#######\n" +
+				".####..\n" +
+				".##....\n",
+		},
+		{
+			name: "clipped fill ellipse",
+			shape: func(plot func(x, y int)) {
+				FillEllipse(3, 2, 3, 2, image.Rect(2, 1, 6, 3), plot)
+			},
+			want: "" +
+				".......\n" +
+				"..####.\n" +
+				"..####.\n" +
+				".......\n" +
+				".......\n",
+		},
+
+		// Shapes with 16-bit coordinates take as long as the part within bounds
+		{
+			name:  "huge fill rect",
+			shape: func(plot func(x, y int)) { FillRect(-32768, -32768, 32767, 32767, bounds, plot) },
+			want:  full,
+		},
+		{
+			name:  "huge fill ellipse",
+			shape: func(plot func(x, y int)) { FillEllipse(3, 2, 32767, 32767, bounds, plot) },
+			want:  full,
+		},
+		{
+			name: "huge fill polygon",
+			shape: func(plot func(x, y int)) {
+				FillPolygon([]image.Point{{-32768, -32768}, {32767, -32768}, {0, 32767}}, bounds, plot)
+			},
+			want: full,
+		},
+		{
+			name:  "huge fill triangle",
+			shape: func(plot func(x, y int)) { FillTriangle(-32768, -32768, 32767, -32768, 0, 32767, bounds, plot) },
+			want:  full,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			if got := grid(t, 7, 5, test.shape); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+// pts builds a slice of points from alternating x and y coordinates.
+func pts(coords ...int) []image.Point {
+	points := make([]image.Point, 0, len(coords)/2)
+	for i := 0; i+1 < len(coords); i += 2 {
+		points = append(points, image.Pt(coords[i], coords[i+1]))
+	}
+	return points
+}
+
+func TestFloodFill(t *testing.T) {
+	walls := "" +
+		"...#...\n" +
+		"...#...\n" +
+		"####...\n" +
+		"..#....\n" +
+		"..#....\n"
+	inside := func(x, y int) bool {
+		return walls[y*8+x] == '.'
+	}
+
+	got := grid(t, 7, 5, func(plot func(x, y int)) {
+		FloodFill(5, 4, image.Rect(0, 0, 7, 5), inside, plot)
+	})
+	want := "" +
+		"....###\n" +
+		"....###\n" +
+		"....###\n" +
+		"...####\n" +
+		"...####\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// grid plots a shape onto a width×height grid of '.' and returns it as lines of text, with
+// '#' marking the plotted pixels. Pixels plotted twice or outside the grid fail the test.
+func grid(t *testing.T, width, height int, shape func(plot func(x, y int))) string {
+	t.Helper()
+
+	cells := make([][]byte, height)
+	for y := range cells {
+		cells[y] = bytes.Repeat([]byte{'.'}, width)
+	}
+	shape(func(x, y int) {
+		if x < 0 || y < 0 || x >= width || y >= height {
+			t.Errorf("pixel (%d, %d) is outside of the %dx%d grid", x, y, width, height)
+			return
+		}
+		if cells[y][x] == '#' {
+			t.Errorf("pixel (%d, %d) was plotted more than once", x, y)
+		}
+		cells[y][x] = '#'
+	})
+
+	var sb strings.Builder
+	for _, row := range cells {
+		sb.Write(row)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
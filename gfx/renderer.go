@@ -0,0 +1,491 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+// Renderer applies a program's drawing operations to an in-memory canvas. It has no
+// dependency on a window, so the same frames can be produced by the windowed host,
+// the headless host and tests.
+type Renderer struct {
+	// Memory is the data section of the program, which operations such as OpDrawText
+	// read from. It is only accessed while handling an Op whose opcode is Sync, and by
+	// Frame.
+	Memory []byte
+
+	// surfaces holds the canvas at index 0, and the offscreen surfaces allocated with
+	// OpNewSurface at the ids returned to the program. Freed ids hold nil.
+	surfaces [maxSurfaces]*surface
+	target   *surface // The surface that drawing operations change, set with OpSetTarget.
+	indexed  bool     // Whether every surface is in the indexed mode.
+
+	color   color.RGBA // The current drawing color, alpha-premultiplied for the canvas.
+	index   byte       // The palette index of the current drawing color.
+	palette [256]color.RGBA
+	clip    image.Rectangle // Drawing operations only change pixels of target within clip.
+	camera  image.Point     // Subtracted from the coordinates of drawing operations and OpGetPixel.
+	blend   byte            // The blend mode of drawing operations, set with OpSetBlendMode.
+
+	// framebuffer is the memory-mapped framebuffer set with OpSetFramebuffer, or nil.
+	framebuffer *Sprite
+
+	// tilemap is the background layer beneath the canvas set with OpSetTilemap, and
+	// sprites is the sprite table drawn over it set with OpSetSpriteTable. Either may be
+	// nil. When they are not, they are drawn onto frame along with the canvas.
+	tilemap          *Tilemap
+	scrollX, scrollY int
+	sprites          *SpriteTable
+	frame            *image.RGBA
+
+	// console is the text console, drawn over the canvas in the palette colors fg and bg
+	// when showConsole is set with OpSetConsole.
+	console              Console
+	showConsole          bool
+	consoleFG, consoleBG byte
+
+	// front is the copy of the canvas made by the last OpPresent, which is displayed in
+	// its place. It is nil until the program first presents, so that programs which never
+	// do are displayed as they draw.
+	front *image.RGBA
+}
+
+func NewRenderer(width, height int) *Renderer {
+	canvas := newSurface(width, height, false)
+	return &Renderer{
+		surfaces: [maxSurfaces]*surface{canvas},
+		target:   canvas,
+		palette:  DefaultPalette,
+		clip:     canvas.image.Rect,
+	}
+}
+
+// Canvas returns the image that operations are drawn onto. It is updated in place.
+//
+// In the indexed mode, Canvas first recolors the image from the indexed framebuffer using
+// the current palette, so palette changes apply to everything drawn before them.
+func (r *Renderer) Canvas() *image.RGBA {
+	canvas := r.surfaces[0]
+	canvas.recolor(&r.palette)
+	return canvas.image
+}
+
+// ShowConsole shows the text console in the palette colors fg and bg, like OpSetConsole,
+// and returns it, so that the host can write the output of a classic program to it. The
+// console must only be written to while the Program is locked.
+func (r *Renderer) ShowConsole(fg, bg byte) *Console {
+	r.showConsole = true
+	r.consoleFG, r.consoleBG = fg, bg
+	return &r.console
+}
+
+// Frame returns the image to display. From back to front, it is composited from the
+// tilemap background and the sprite table, if the program has set them, the canvas, or
+// the front buffer once the program has used OpPresent, and the text console, if it is
+// shown. The memory-mapped framebuffer, if there is one, is copied onto the canvas first.
+//
+// The host calls Frame once per frame while the Program is locked, because the layers are
+// read from its memory and sprite collisions are written to it. The image is only valid
+// until the next call.
+func (r *Renderer) Frame() *image.RGBA {
+	if r.framebuffer != nil {
+		Blit(*r.framebuffer, 0, 0, 0, 0, func(x, y int, index byte) {
+			r.surfaces[0].set(x, y, index, r.palette[index])
+		})
+	}
+
+	canvas := r.Canvas()
+	if r.front != nil {
+		canvas = r.front
+	}
+	if r.tilemap == nil && r.sprites == nil && !r.showConsole {
+		return canvas
+	}
+
+	if r.frame == nil {
+		r.frame = image.NewRGBA(canvas.Rect)
+	}
+	if r.tilemap != nil {
+		for y := range r.frame.Rect.Dy() {
+			for x := range r.frame.Rect.Dx() {
+				index := r.tilemap.At(x+r.scrollX, y+r.scrollY)
+				r.frame.SetRGBA(x, y, r.palette[index])
+			}
+		}
+	} else {
+		clear(r.frame.Pix)
+	}
+	if r.sprites != nil {
+		r.sprites.Draw(r.frame.Rect, func(x, y int, index byte) {
+			r.frame.SetRGBA(x, y, r.palette[index])
+		})
+	}
+	draw.Draw(r.frame, r.frame.Rect, canvas, image.Point{}, draw.Over)
+	if r.showConsole {
+		fg, bg := r.palette[r.consoleFG], r.palette[r.consoleBG]
+		r.console.Draw(func(x, y int, isFG bool) {
+			c := bg
+			if isFG {
+				c = fg
+			}
+			if image.Pt(x, y).In(r.frame.Rect) {
+				r.frame.SetRGBA(x, y, Blend(r.frame.RGBAAt(x, y), c, BlendOver))
+			}
+		})
+	}
+	return r.frame
+}
+
+// Op applies a single operation to the canvas and returns the bytes that it outputs to the
+// program, if any. Operations that are not for the renderer are ignored.
+func (r *Renderer) Op(op vm.Op) (out []byte) {
+	switch op.Code {
+	case vm.OpClearCanvas:
+		r.target.clear()
+	case vm.OpSetColor:
+		r.color = premultiply(op.Byte(3), op.Byte(2), op.Byte(1), op.Byte(0))
+		r.index = r.nearest(r.color)
+	case vm.OpSetPalette:
+		r.palette[op.Byte(4)] = premultiply(op.Byte(3), op.Byte(2), op.Byte(1), op.Byte(0))
+	case vm.OpSetColorIndex:
+		r.index = op.Byte(0)
+		r.color = r.palette[r.index]
+	case vm.OpSetIndexedMode:
+		r.indexed = op.Byte(0) != 0
+		for _, s := range r.surfaces {
+			if s != nil {
+				s.recolor(&r.palette) // Keep the last indexed frame on the surface
+				s.setIndexed(r.indexed)
+			}
+		}
+	case vm.OpSetClip, vm.OpSetClip16:
+		c, _ := coords(op, 4, 0)
+		x1, y1, x2, y2 := c[0], c[1], c[2], c[3]
+		// The corners are inclusive, while the Max of an image.Rectangle is exclusive.
+		clip := image.Rect(min(x1, x2), min(y1, y2), max(x1, x2)+1, max(y1, y2)+1)
+		r.clip = clip.Intersect(r.target.image.Rect)
+	case vm.OpSetCamera:
+		r.camera.X = int(int16(op.Word(2)))
+		r.camera.Y = int(int16(op.Word(0)))
+	case vm.OpSetPixel, vm.OpSetPixel16:
+		c, _ := coords(op, 2, 0)
+		r.plot(c[0], c[1])
+	case vm.OpDrawLine, vm.OpDrawLine16:
+		c, _ := coords(op, 4, 0)
+		Line(c[0], c[1], c[2], c[3], r.plot)
+	case vm.OpDrawRect, vm.OpDrawRect16:
+		c, _ := coords(op, 4, 0)
+		Rect(c[0], c[1], c[2], c[3], r.plot)
+	case vm.OpFillRect, vm.OpFillRect16:
+		c, _ := coords(op, 4, 0)
+		FillRect(c[0], c[1], c[2], c[3], r.bounds(), r.plot)
+	case vm.OpDrawEllipse, vm.OpDrawEllipse16:
+		c, _ := coords(op, 4, 0)
+		Ellipse(c[0], c[1], c[2], c[3], r.plot)
+	case vm.OpFillEllipse, vm.OpFillEllipse16:
+		c, _ := coords(op, 4, 0)
+		FillEllipse(c[0], c[1], c[2], c[3], r.bounds(), r.plot)
+	case vm.OpFillTriangle, vm.OpFillTriangle16:
+		c, _ := coords(op, 6, 0)
+		FillTriangle(c[0], c[1], c[2], c[3], c[4], c[5], r.bounds(), r.plot)
+	case vm.OpFloodFill, vm.OpFloodFill16:
+		c, _ := coords(op, 2, 0)
+		r.floodFill(c[0], c[1])
+	case vm.OpFillPolygon, vm.OpFillPolygon16:
+		addr := int(op.Word(1))
+		n := int(op.Byte(0))
+		vertices := make([]image.Point, n)
+		for i := range vertices {
+			if op.Code == vm.OpFillPolygon16 {
+				vertices[i].X = int(int16(r.word(addr + i*4)))
+				vertices[i].Y = int(int16(r.word(addr + i*4 + 2)))
+			} else {
+				vertices[i].X = int(r.byte(addr + i*2))
+				vertices[i].Y = int(r.byte(addr + i*2 + 1))
+			}
+		}
+		FillPolygon(vertices, r.bounds(), r.plot)
+	case vm.OpDrawChar, vm.OpDrawChar16:
+		c, i := coords(op, 2, 0)
+		Char(op.Byte(i), c[0], c[1], r.plot)
+	case vm.OpDrawText, vm.OpDrawText16:
+		c, i := coords(op, 2, 0)
+		r.text(int(op.Word(i)), c[0], c[1])
+	case vm.OpSetFramebuffer:
+		addr := int(op.Word(1))
+		mode := op.Byte(0)
+		if mode == 0 {
+			r.framebuffer = nil
+			break
+		}
+		r.framebuffer = &Sprite{
+			Data:   r.memory(addr),
+			W:      r.surfaces[0].image.Rect.Dx(),
+			H:      r.surfaces[0].image.Rect.Dy(),
+			Format: int(mode-1) & spriteFormatMask,
+		}
+	case vm.OpSetTilemap:
+		mapAddr := int(op.Word(5))
+		w := int(op.Byte(4))
+		h := int(op.Byte(3))
+		tilesAddr := int(op.Word(1))
+		mode := op.Byte(0)
+		if mode == 0 {
+			r.tilemap = nil
+			break
+		}
+		r.tilemap = &Tilemap{
+			Map:    r.memory(mapAddr),
+			Tiles:  r.memory(tilesAddr),
+			W:      w,
+			H:      h,
+			Format: int(mode-1) & spriteFormatMask,
+		}
+	case vm.OpSetSpriteTable, vm.OpSetSpriteTable16:
+		tableAddr := int(op.Word(3))
+		tilesAddr := int(op.Word(1))
+		mode := op.Byte(0)
+		if mode == 0 {
+			r.sprites = nil
+			break
+		}
+		r.sprites = &SpriteTable{
+			Memory: r.memory(tableAddr),
+			Tiles:  r.memory(tilesAddr),
+			Format: int(mode-1) & spriteFormatMask,
+			Wide:   op.Code.Wide(),
+		}
+	case vm.OpSetScroll:
+		r.scrollX = int(op.Word(2))
+		r.scrollY = int(op.Word(0))
+	case vm.OpBlit, vm.OpBlit16:
+		c, i := coords(op, 2, 4)
+		addr := int(op.Word(i))
+		flags := op.Byte(1)
+		key := op.Byte(0)
+		sprite := Sprite{
+			Data:   r.memory(addr),
+			W:      int(op.Byte(3)),
+			H:      int(op.Byte(2)),
+			Format: int(flags & spriteFormatMask),
+		}
+		Blit(sprite, c[0], c[1], flags, key, func(x, y int, index byte) {
+			r.draw(x, y, index, r.palette[index])
+		})
+	case vm.OpBlitTransformed:
+		flags := op.Byte(4)
+		sprite := Sprite{
+			Data:   r.memory(int(op.Word(11))),
+			W:      int(op.Byte(6)),
+			H:      int(op.Byte(5)),
+			Format: int(flags & spriteFormatMask),
+		}
+		x, y := int(int16(op.Word(9))), int(int16(op.Word(7)))
+		scale, angle := int(op.Word(1)), op.Byte(0)
+		BlitTransformed(sprite, x, y, scale, angle, flags, op.Byte(3), r.bounds(), func(x, y int, index byte) {
+			r.draw(x, y, index, r.palette[index])
+		})
+	case vm.OpGetPixel, vm.OpGetPixel16:
+		c, _ := coords(op, 2, 0)
+		p := image.Pt(c[0], c[1]).Sub(r.camera) // The pixel that drawing at (x, y) changes
+		pixel := color.NRGBAModel.Convert(r.target.at(p.X, p.Y, &r.palette)).(color.NRGBA)
+		return []byte{pixel.R, pixel.G, pixel.B, pixel.A}
+	case vm.OpGetCanvasSize:
+		w, h := r.surfaces[0].image.Rect.Dx(), r.surfaces[0].image.Rect.Dy()
+		return []byte{byte(w >> 8), byte(w), byte(h >> 8), byte(h)}
+	case vm.OpSetBlendMode:
+		r.blend = op.Byte(0)
+	case vm.OpSetConsole:
+		r.showConsole = op.Byte(2) != 0
+		r.consoleFG, r.consoleBG = op.Byte(1), op.Byte(0)
+	case vm.OpPrintChar:
+		r.console.WriteByte(op.Byte(0))
+	case vm.OpPrintText:
+		for i := int(op.Word(0)); i < len(r.Memory) && r.Memory[i] != 0; i++ {
+			r.console.WriteByte(r.Memory[i])
+		}
+	case vm.OpSetCursor:
+		r.console.SetCursor(int(op.Byte(1)), int(op.Byte(0)))
+	case vm.OpPresent:
+		canvas := r.Canvas()
+		if r.front == nil {
+			r.front = image.NewRGBA(canvas.Rect)
+		}
+		copy(r.front.Pix, canvas.Pix)
+	case vm.OpNewSurface:
+		w, h := int(op.Word(2)), int(op.Word(0))
+		if w < 1 || h < 1 || w > maxSurfaceSize || h > maxSurfaceSize {
+			return []byte{0}
+		}
+		for id := 1; id < len(r.surfaces); id++ {
+			if r.surfaces[id] == nil {
+				r.surfaces[id] = newSurface(w, h, r.indexed)
+				return []byte{byte(id)}
+			}
+		}
+		return []byte{0} // Every id is in use
+	case vm.OpFreeSurface:
+		if id := int(op.Byte(0)); id > 0 && id < len(r.surfaces) && r.surfaces[id] != nil {
+			if r.target == r.surfaces[id] {
+				r.setTarget(r.surfaces[0])
+			}
+			r.surfaces[id] = nil
+		}
+	case vm.OpSetTarget:
+		if s := r.surface(op.Byte(0)); s != nil {
+			r.setTarget(s)
+		}
+	case vm.OpCopyRect:
+		src, dst := r.surface(op.Byte(13)), r.surface(op.Byte(4))
+		if src == nil || dst == nil {
+			break
+		}
+		sp := image.Pt(int(int16(op.Word(11))), int(int16(op.Word(9))))
+		size := image.Pt(int(op.Word(7)), int(op.Word(5)))
+		dp := image.Pt(int(int16(op.Word(2))), int(int16(op.Word(0))))
+		copyRect(dst, dp, src, sp, size)
+	}
+	return nil
+}
+
+// coords decodes n coordinates from the arguments of op, in order, when they are followed
+// by skip bytes of other arguments. Coordinates are bytes for the 8-bit drawing opcodes,
+// and signed words for their 16-bit variants. The index of the argument byte right before
+// the coordinates is returned along with them, for use with op.Byte and op.Word.
+func coords(op vm.Op, n, skip int) (c []int, next int) {
+	size := 1
+	if op.Code.Wide() {
+		size = 2
+	}
+
+	c = make([]int, n)
+	for i := range c {
+		idx := skip + (n-1-i)*size
+		if size == 2 {
+			c[i] = int(int16(op.Word(idx)))
+		} else {
+			c[i] = int(op.Byte(idx))
+		}
+	}
+	return c, skip + n*size
+}
+
+// surface returns the surface with the given id, or nil if there is none.
+func (r *Renderer) surface(id byte) *surface {
+	if int(id) >= len(r.surfaces) {
+		return nil
+	}
+	return r.surfaces[id]
+}
+
+// setTarget makes s the target of drawing operations, and resets the clip rectangle to
+// its bounds.
+func (r *Renderer) setTarget(s *surface) {
+	r.target = s
+	r.clip = s.image.Rect
+}
+
+// memory returns Memory from addr onwards, or nil if addr is past its end.
+func (r *Renderer) memory(addr int) []byte {
+	if addr >= len(r.Memory) {
+		return nil
+	}
+	return r.Memory[addr:]
+}
+
+// byte returns Memory[addr], or 0 if addr is past its end.
+func (r *Renderer) byte(addr int) byte {
+	if addr >= len(r.Memory) {
+		return 0
+	}
+	return r.Memory[addr]
+}
+
+// word returns the big-endian word at Memory[addr], with bytes past its end read as 0.
+func (r *Renderer) word(addr int) uint16 {
+	return uint16(r.byte(addr))<<8 | uint16(r.byte(addr+1))
+}
+
+// floodFill fills the area around (x, y) that has the same color, or the same palette
+// index in the indexed mode, with the current color. The area ends at the clip rectangle.
+func (r *Renderer) floodFill(x, y int) {
+	start := image.Pt(x, y).Sub(r.camera)
+	x, y = start.X, start.Y
+	if !start.In(r.clip) {
+		return
+	}
+
+	s := r.target
+	target := s.at(x, y, &r.palette)
+	inside := func(x, y int) bool {
+		return s.at(x, y, &r.palette) == target
+	}
+	if s.indices != nil {
+		w := s.image.Rect.Dx()
+		targetIndex := s.indices[y*w+x]
+		inside = func(x, y int) bool {
+			return s.indices[y*w+x] == targetIndex
+		}
+	}
+	FloodFill(x, y, r.clip, inside, func(x, y int) {
+		s.blend(x, y, r.index, r.color, &r.palette, r.blend)
+	})
+}
+
+// text draws the NUL-terminated string at Memory[addr] with its top-left corner at (x, y).
+// A newline moves the following characters one line down, back to x.
+func (r *Renderer) text(addr, x, y int) {
+	col := x
+	for i := addr; i < len(r.Memory) && r.Memory[i] != 0; i++ {
+		if r.Memory[i] == '\n' {
+			col = x
+			y += 8
+			continue
+		}
+		Char(r.Memory[i], col, y, r.plot)
+		col += 8
+	}
+}
+
+// bounds returns the area that drawing operations can change, in their coordinates: the
+// clip rectangle offset by the camera. Shapes are limited to it before they are rasterized.
+func (r *Renderer) bounds() image.Rectangle {
+	return r.clip.Add(r.camera)
+}
+
+// plot draws the pixel at (x, y) in the current color.
+func (r *Renderer) plot(x, y int) {
+	r.draw(x, y, r.index, r.color)
+}
+
+// draw blends c, or the palette index in the indexed mode, onto the pixel of the target at
+// (x, y) offset by the camera, in the current blend mode. Pixels outside the clip rectangle
+// are discarded. All drawing operations go through draw.
+func (r *Renderer) draw(x, y int, index byte, c color.RGBA) {
+	p := image.Pt(x, y).Sub(r.camera)
+	if p.In(r.clip) {
+		r.target.blend(p.X, p.Y, index, c, &r.palette, r.blend)
+	}
+}
+
+// nearest returns the index of the palette color closest to c.
+func (r *Renderer) nearest(c color.RGBA) byte {
+	best, bestDist := 0, math.MaxInt
+	for i, p := range r.palette {
+		dr, dg := int(p.R)-int(c.R), int(p.G)-int(c.G)
+		db, da := int(p.B)-int(c.B), int(p.A)-int(c.A)
+		if dist := dr*dr + dg*dg + db*db + da*da; dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return byte(best)
+}
+
+// premultiply returns the alpha-premultiplied form of a non-alpha-premultiplied color.
+func premultiply(r, g, b, a byte) color.RGBA {
+	return color.RGBAModel.Convert(color.NRGBA{R: r, G: g, B: b, A: a}).(color.RGBA)
+}
@@ -0,0 +1,558 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+func TestRendererOps(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	clear := color.RGBA{}
+
+	r := NewRenderer(8, 8)
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpSetPixel, 1, 2))
+	r.Op(vm.NewOp(vm.OpDrawLine, 0, 7, 3, 7))
+	r.Op(vm.NewOp(vm.OpSetPixel, 200, 200)) // Off canvas
+	r.Op(vm.NewOp(vm.OpFillRect, 5, 5, 6, 6))
+	r.Op(vm.NewOp(vm.OpFillEllipse, 6, 1, 1, 1))
+
+	table := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{1, 2, red},
+		{0, 7, red},
+		{3, 7, red},
+		{4, 7, clear},
+		{5, 5, red},
+		{6, 6, red},
+		{4, 5, clear},
+		{6, 2, red},
+		{7, 1, red},
+		{7, 2, clear},
+		{0, 0, clear},
+	}
+	for _, test := range table {
+		if got := r.Canvas().RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	r.Op(vm.NewOp(vm.OpClearCanvas))
+	for i, b := range r.Canvas().Pix {
+		if b != 0 {
+			t.Fatalf("Pix[%d] = %d after OpClearCanvas, want 0", i, b)
+		}
+	}
+}
+
+func TestRendererProgram(t *testing.T) {
+	// SetColor(0, 0, 0, 255) then SetPixel(3, 4).
+	code := []byte("-> ++++++++++ ++++++++++ ++++++++++ ++++++++++ + . [-]<[-]" +
+		"+++>++++>++++++++++ ++++++++++ ++++++++++ ++++++++++ ++.")
+	p, err := vm.NewProgram(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opChan := make(chan vm.Op, 8)
+	if err := p.Run(opChan); err != nil {
+		t.Fatal(err)
+	}
+	close(opChan)
+
+	r := NewRenderer(8, 8)
+	for op := range opChan {
+		r.Op(op)
+	}
+
+	want := color.RGBA{0, 0, 0, 255}
+	if got := r.Canvas().RGBAAt(3, 4); got != want {
+		t.Errorf("pixel (3, 4) = %v, want %v", got, want)
+	}
+}
+
+func TestRendererText(t *testing.T) {
+	text := NewRenderer(24, 16)
+	text.Memory = []byte("\x00\x00Hi\nA\x00B")
+	text.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	text.Op(vm.NewOp(vm.OpDrawText, 0, 2, 4, 0))
+
+	chars := NewRenderer(24, 16)
+	chars.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	chars.Op(vm.NewOp(vm.OpDrawChar, 'H', 4, 0))
+	chars.Op(vm.NewOp(vm.OpDrawChar, 'i', 12, 0))
+	chars.Op(vm.NewOp(vm.OpDrawChar, 'A', 4, 8))
+
+	if !bytes.Equal(text.Canvas().Pix, chars.Canvas().Pix) {
+		t.Error("OpDrawText did not draw the same pixels as the equivalent OpDrawChar operations")
+	}
+}
+
+func TestRendererBlit(t *testing.T) {
+	r := NewRenderer(4, 4)
+	r.Memory = []byte{0, 1, 2, 0, 3}
+	r.Op(vm.NewOp(vm.OpBlit, 0, 1, 1, 1, 2, 2, Sprite8Bit|SpriteColorKey, 0))
+
+	table := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{1, 1, DefaultPalette[1]},
+		{2, 1, DefaultPalette[2]},
+		{1, 2, color.RGBA{}}, // Color key
+		{2, 2, DefaultPalette[3]},
+	}
+	for _, test := range table {
+		if got := r.Canvas().RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestRendererIndexedMode(t *testing.T) {
+	r := NewRenderer(4, 4)
+	r.Op(vm.NewOp(vm.OpSetIndexedMode, 1))
+	r.Op(vm.NewOp(vm.OpSetColorIndex, 7))
+	r.Op(vm.NewOp(vm.OpSetPixel, 1, 1))
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255)) // Nearest to palette[1]
+	r.Op(vm.NewOp(vm.OpSetPixel, 2, 2))
+
+	if got, want := r.Canvas().RGBAAt(1, 1), DefaultPalette[7]; got != want {
+		t.Errorf("pixel (1, 1) = %v, want %v", got, want)
+	}
+	if got, want := r.Canvas().RGBAAt(2, 2), DefaultPalette[1]; got != want {
+		t.Errorf("pixel (2, 2) = %v, want %v", got, want)
+	}
+
+	// Changing the palette recolors pixels that have already been drawn.
+	r.Op(vm.NewOp(vm.OpSetPalette, 7, 10, 20, 30, 255))
+	if got, want := r.Canvas().RGBAAt(1, 1), (color.RGBA{10, 20, 30, 255}); got != want {
+		t.Errorf("pixel (1, 1) = %v after OpSetPalette, want %v", got, want)
+	}
+
+	// Leaving the indexed mode keeps the frame, but palette changes no longer apply to it.
+	r.Op(vm.NewOp(vm.OpSetIndexedMode, 0))
+	r.Op(vm.NewOp(vm.OpSetPalette, 7, 0, 0, 0, 255))
+	if got, want := r.Canvas().RGBAAt(1, 1), (color.RGBA{10, 20, 30, 255}); got != want {
+		t.Errorf("pixel (1, 1) = %v after leaving the indexed mode, want %v", got, want)
+	}
+}
+
+func TestRendererFramebuffer(t *testing.T) {
+	r := NewRenderer(8, 2)
+	r.Memory = []byte{0, 0b1000_0001, 0b0100_0000}
+	r.Op(vm.NewOp(vm.OpSetFramebuffer, 0, 1, 1))
+
+	// Cells written after the framebuffer is set are displayed by the next Frame.
+	r.Memory[2] |= 0b0000_0010
+	r.Frame()
+
+	want := "#......#\n.#....#.\n"
+	var got []byte
+	for y := range 2 {
+		for x := range 8 {
+			if r.Canvas().RGBAAt(x, y) == DefaultPalette[1] {
+				got = append(got, '#')
+			} else {
+				got = append(got, '.')
+			}
+		}
+		got = append(got, '\n')
+	}
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRendererTilemap(t *testing.T) {
+	r := NewRenderer(8, 8)
+	r.Memory = []byte{
+		0,                         // Map of a single tile
+		0xF0, 0, 0, 0, 0, 0, 0, 0, // Tile 0
+	}
+	r.Op(vm.NewOp(vm.OpSetTilemap, 0, 0, 1, 1, 0, 1, 1))
+	r.Op(vm.NewOp(vm.OpSetScroll, 0, 2, 0, 0))
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpSetPixel, 0, 0))
+
+	frame := r.Frame()
+	table := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{255, 0, 0, 255}}, // The canvas is drawn over the tilemap
+		{1, 0, DefaultPalette[1]},
+		{2, 0, DefaultPalette[0]},
+		{6, 0, DefaultPalette[1]},
+		{0, 1, DefaultPalette[0]},
+	}
+	for _, test := range table {
+		if got := frame.RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestRendererQueries(t *testing.T) {
+	r := NewRenderer(300, 4)
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 128, 0, 255))
+	r.Op(vm.NewOp(vm.OpSetPixel, 1, 2))
+
+	table := []struct {
+		op   vm.Op
+		want []byte
+	}{
+		{vm.NewOp(vm.OpGetPixel, 1, 2), []byte{255, 128, 0, 255}},
+		{vm.NewOp(vm.OpGetPixel, 0, 0), []byte{0, 0, 0, 0}},
+		{vm.NewOp(vm.OpGetCanvasSize), []byte{1, 44, 0, 4}},
+	}
+	for _, test := range table {
+		if got := r.Op(test.op); !bytes.Equal(got, test.want) {
+			t.Errorf("%v returned %v, want %v", test.op.Code, got, test.want)
+		}
+	}
+
+	// In the indexed mode the pixel has the color of its palette entry.
+	r.Op(vm.NewOp(vm.OpSetIndexedMode, 1))
+	r.Op(vm.NewOp(vm.OpSetColorIndex, 2))
+	r.Op(vm.NewOp(vm.OpSetPixel, 1, 2))
+	c := DefaultPalette[2]
+	if got, want := r.Op(vm.NewOp(vm.OpGetPixel, 1, 2)), []byte{c.R, c.G, c.B, c.A}; !bytes.Equal(got, want) {
+		t.Errorf("OpGetPixel returned %v in the indexed mode, want %v", got, want)
+	}
+}
+
+func TestRendererFill(t *testing.T) {
+	r := NewRenderer(8, 8)
+	r.Memory = []byte{9, 1, 1, 6, 1, 6, 6, 1, 6} // A square at Memory[1:]
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	r.Op(vm.NewOp(vm.OpDrawRect, 0, 0, 7, 7))
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpFloodFill, 3, 3))
+
+	white, red := color.RGBA{255, 255, 255, 255}, color.RGBA{255, 0, 0, 255}
+	if got := r.Canvas().RGBAAt(0, 3); got != white {
+		t.Errorf("pixel (0, 3) = %v, want the white border", got)
+	}
+	if got := r.Canvas().RGBAAt(6, 6); got != red {
+		t.Errorf("pixel (6, 6) = %v, want %v", got, red)
+	}
+
+	r.Op(vm.NewOp(vm.OpSetColor, 0, 0, 255, 255))
+	r.Op(vm.NewOp(vm.OpFillPolygon, 0, 1, 4))
+	blue := color.RGBA{0, 0, 255, 255}
+	for _, p := range []image.Point{{1, 1}, {6, 6}, {3, 4}} {
+		if got := r.Canvas().RGBAAt(p.X, p.Y); got != blue {
+			t.Errorf("pixel %v = %v, want %v", p, got, blue)
+		}
+	}
+	if got := r.Canvas().RGBAAt(7, 7); got != white {
+		t.Errorf("pixel (7, 7) = %v, want the white border", got)
+	}
+}
+
+func TestRendererClipCamera(t *testing.T) {
+	r := NewRenderer(8, 8)
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	r.Op(vm.NewOp(vm.OpSetCamera, 0xFF, 0xFE, 0, 3)) // x = -2, y = 3
+	r.Op(vm.NewOp(vm.OpSetClip, 5, 5, 1, 1))
+	r.Op(vm.NewOp(vm.OpFillRect, 0, 0, 255, 255))
+
+	var got []byte
+	for y := range 8 {
+		for x := range 8 {
+			if r.Canvas().RGBAAt(x, y).A != 0 {
+				got = append(got, '#')
+			} else {
+				got = append(got, '.')
+			}
+		}
+		got = append(got, '\n')
+	}
+	// The rectangle starts at (2, -3) on the canvas, and is clipped to (1, 1)-(5, 5).
+	want := "" +
+		"........\n" +
+		"..####..\n" +
+		"..####..\n" +
+		"..####..\n" +
+		"..####..\n" +
+		"..####..\n" +
+		"........\n" +
+		"........\n"
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Pixels are read back at the same coordinates as they are drawn
+	if got := r.Op(vm.NewOp(vm.OpGetPixel, 0, 4)); !bytes.Equal(got, []byte{255, 255, 255, 255}) {
+		t.Errorf("OpGetPixel at (0, 4) = %v, want the pixel drawn at (2, 1) on the canvas", got)
+	}
+	if got := r.Op(vm.NewOp(vm.OpGetPixel, 2, 1)); !bytes.Equal(got, []byte{0, 0, 0, 0}) {
+		t.Errorf("OpGetPixel at (2, 1) = %v, want the transparent pixel at (4, -2)", got)
+	}
+}
+
+func TestRenderer16Bit(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+
+	r := NewRenderer(320, 4)
+	r.Memory = []byte{
+		0x01, 0x2C, 0x00, 0x03, // (300, 3)
+		0x01, 0x2F, 0x00, 0x03, // (303, 3)
+		0x01, 0x2F, 0xFF, 0xFF, // (303, -1)
+	}
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpSetPixel16, 0x01, 0x3F, 0, 0))                   // (319, 0)
+	r.Op(vm.NewOp(vm.OpDrawLine16, 0xFF, 0xFE, 0, 1, 0x01, 0x00, 0, 1)) // (-2, 1) to (256, 1)
+	r.Op(vm.NewOp(vm.OpFillPolygon16, 0, 0, 3))
+
+	table := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{319, 0, red},
+		{318, 0, color.RGBA{}},
+		{0, 1, red},
+		{256, 1, red},
+		{257, 1, color.RGBA{}},
+		{300, 3, red},
+		{303, 0, red},
+		{299, 3, color.RGBA{}},
+	}
+	for _, test := range table {
+		if got := r.Canvas().RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	if got, want := r.Op(vm.NewOp(vm.OpGetPixel16, 0x01, 0x00, 0, 1)), []byte{255, 0, 0, 255}; !bytes.Equal(got, want) {
+		t.Errorf("OpGetPixel16 at (256, 1) = %v, want %v", got, want)
+	}
+
+	// The 8-bit and 16-bit variants of an opcode draw the same pixels
+	small, wide := NewRenderer(16, 16), NewRenderer(16, 16)
+	small.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	small.Op(vm.NewOp(vm.OpDrawChar, 'A', 3, 4))
+	small.Op(vm.NewOp(vm.OpFillTriangle, 0, 0, 15, 2, 4, 15))
+	wide.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	wide.Op(vm.NewOp(vm.OpDrawChar16, 'A', 0, 3, 0, 4))
+	wide.Op(vm.NewOp(vm.OpFillTriangle16, 0, 0, 0, 0, 0, 15, 0, 2, 0, 4, 0, 15))
+	if !bytes.Equal(small.Canvas().Pix, wide.Canvas().Pix) {
+		t.Error("the 16-bit opcodes did not draw the same pixels as their 8-bit variants")
+	}
+
+	// Shapes far larger than the canvas are limited to the clip rectangle under the camera
+	huge := NewRenderer(4, 4)
+	huge.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	huge.Op(vm.NewOp(vm.OpSetCamera, 0, 2, 0, 0))
+	huge.Op(vm.NewOp(vm.OpSetClip, 0, 0, 1, 3))
+	huge.Op(vm.NewOp(vm.OpFillRect16, 0xC0, 0x00, 0xC0, 0x00, 0x3F, 0xFF, 0x3F, 0xFF)) // -16384 to 16383
+	huge.Op(vm.NewOp(vm.OpFillEllipse16, 0, 0, 0, 0, 0x7F, 0xFF, 0x7F, 0xFF))
+	huge.Op(vm.NewOp(vm.OpFillTriangle16, 0x80, 0x00, 0x80, 0x00, 0x7F, 0xFF, 0x80, 0x00, 0, 0, 0x7F, 0xFF))
+	for y := range 4 {
+		for x := range 4 {
+			if got, want := huge.Canvas().RGBAAt(x, y), x <= 1; (got == red) != want {
+				t.Errorf("pixel (%d, %d) = %v after filling the clip rectangle", x, y, got)
+			}
+		}
+	}
+}
+
+func TestRendererSurfaces(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+
+	r := NewRenderer(8, 8)
+	id := r.Op(vm.NewOp(vm.OpNewSurface, 0, 4, 0, 4))
+	if len(id) != 1 || id[0] == 0 {
+		t.Fatalf("OpNewSurface = %v, want a surface id", id)
+	}
+	if got := r.Op(vm.NewOp(vm.OpNewSurface, 0, 0, 0, 4)); !bytes.Equal(got, []byte{0}) {
+		t.Errorf("OpNewSurface with a width of 0 = %v, want [0]", got)
+	}
+
+	// Draw onto the offscreen surface, which leaves the canvas alone
+	r.Op(vm.NewOp(vm.OpSetTarget, id[0]))
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpFillRect, 0, 0, 255, 255)) // Clipped to the 4x4 surface
+	r.Op(vm.NewOp(vm.OpSetTarget, 0))
+	if got := r.Canvas().RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Fatalf("canvas pixel (0, 0) = %v after drawing offscreen, want transparent", got)
+	}
+
+	// Copy 3x3 pixels from (2, 2) of the surface, of which only 2x2 exist, to (6, -1) on
+	// the canvas, of which only (6, 0)-(7, 0) exist.
+	r.Op(vm.NewOp(vm.OpCopyRect, id[0], 0, 2, 0, 2, 0, 3, 0, 3, 0, 0, 6, 0xFF, 0xFF))
+	for _, test := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{6, 0, red},
+		{7, 0, red},
+		{5, 0, color.RGBA{}},
+		{6, 1, color.RGBA{}},
+	} {
+		if got := r.Canvas().RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	// Freeing the target draws to the canvas again, and the id can be reused
+	r.Op(vm.NewOp(vm.OpSetTarget, id[0]))
+	r.Op(vm.NewOp(vm.OpFreeSurface, id[0]))
+	r.Op(vm.NewOp(vm.OpSetPixel, 1, 1))
+	if got := r.Canvas().RGBAAt(1, 1); got != red {
+		t.Errorf("pixel (1, 1) = %v after freeing the target, want %v", got, red)
+	}
+	if got := r.Op(vm.NewOp(vm.OpNewSurface, 0, 1, 0, 1)); !bytes.Equal(got, id) {
+		t.Errorf("OpNewSurface after OpFreeSurface = %v, want %v", got, id)
+	}
+}
+
+func TestRendererPresent(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+
+	r := NewRenderer(4, 4)
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpSetPixel, 1, 1))
+	if got := r.Frame().RGBAAt(1, 1); got != red {
+		t.Fatalf("pixel (1, 1) = %v before any OpPresent, want %v", got, red)
+	}
+
+	r.Op(vm.NewOp(vm.OpPresent, 0))
+	r.Op(vm.NewOp(vm.OpClearCanvas))
+	r.Op(vm.NewOp(vm.OpSetPixel, 2, 2))
+	frame := r.Frame()
+	if got := frame.RGBAAt(1, 1); got != red {
+		t.Errorf("pixel (1, 1) = %v after clearing the back buffer, want the presented %v", got, red)
+	}
+	if got := frame.RGBAAt(2, 2); got != (color.RGBA{}) {
+		t.Errorf("pixel (2, 2) = %v before it is presented, want transparent", got)
+	}
+
+	r.Op(vm.NewOp(vm.OpPresent, 1))
+	if got := r.Frame().RGBAAt(2, 2); got != red {
+		t.Errorf("pixel (2, 2) = %v after OpPresent, want %v", got, red)
+	}
+}
+
+func TestRendererBlitTransformed(t *testing.T) {
+	r := NewRenderer(4, 4)
+	r.Memory = []byte{0, 1, 2, 3, 4}
+	// A quarter turn of the 2x2 sprite at Memory[1:], centered on (2, 2)
+	r.Op(vm.NewOp(vm.OpBlitTransformed, 0, 1, 0, 2, 0, 2, 2, 2, Sprite8Bit, 0, 1, 0, 64))
+
+	table := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{1, 1, DefaultPalette[3]},
+		{2, 1, DefaultPalette[1]},
+		{1, 2, DefaultPalette[4]},
+		{2, 2, DefaultPalette[2]},
+		{0, 0, color.RGBA{}},
+	}
+	for _, test := range table {
+		if got := r.Canvas().RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestRendererBlendMode(t *testing.T) {
+	r := NewRenderer(4, 4)
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 0, 0, 255))
+	r.Op(vm.NewOp(vm.OpFillRect, 0, 0, 3, 3))
+
+	r.Op(vm.NewOp(vm.OpSetBlendMode, BlendAdd))
+	r.Op(vm.NewOp(vm.OpSetColor, 0, 0, 255, 255))
+	r.Op(vm.NewOp(vm.OpSetPixel, 0, 0))
+	if got, want := r.Canvas().RGBAAt(0, 0), (color.RGBA{255, 0, 255, 255}); got != want {
+		t.Errorf("added pixel = %v, want %v", got, want)
+	}
+
+	// Drawing the same shape twice in the XOR mode erases it
+	before := bytes.Clone(r.Canvas().Pix)
+	r.Op(vm.NewOp(vm.OpSetBlendMode, BlendXOR))
+	r.Op(vm.NewOp(vm.OpSetColor, 255, 255, 255, 255))
+	r.Op(vm.NewOp(vm.OpFillEllipse, 2, 2, 1, 1))
+	if bytes.Equal(r.Canvas().Pix, before) {
+		t.Fatal("XOR drawing did not change the canvas")
+	}
+	r.Op(vm.NewOp(vm.OpFillEllipse, 2, 2, 1, 1))
+	if !bytes.Equal(r.Canvas().Pix, before) {
+		t.Error("XOR drawing twice did not restore the canvas")
+	}
+}
+
+func TestRendererBlendXORTilemap(t *testing.T) {
+	for _, indexed := range []byte{0, 1} {
+		r := NewRenderer(8, 8)
+		r.Memory = []byte{
+			0,                                              // Map of a single tile
+			0xF0, 0x0F, 0xF0, 0x0F, 0xF0, 0x0F, 0xF0, 0x0F, // Tile 0
+		}
+		r.Op(vm.NewOp(vm.OpSetTilemap, 0, 0, 1, 1, 0, 1, 1))
+		r.Op(vm.NewOp(vm.OpSetPalette, 0, 0, 0, 0, 0)) // The canvas is transparent in both modes
+		r.Op(vm.NewOp(vm.OpSetIndexedMode, indexed))
+		r.Op(vm.NewOp(vm.OpSetBlendMode, BlendXOR))
+		r.Op(vm.NewOp(vm.OpSetColorIndex, 5))
+		before := bytes.Clone(r.Frame().Pix)
+
+		r.Op(vm.NewOp(vm.OpFillRect, 2, 2, 5, 5))
+		if got := r.Frame().RGBAAt(3, 3); indexed == 1 && got != DefaultPalette[5] {
+			t.Errorf("indexed XOR drawing over the tilemap = %v, want %v", got, DefaultPalette[5])
+		}
+		r.Op(vm.NewOp(vm.OpFillRect, 2, 2, 5, 5))
+		if !bytes.Equal(r.Frame().Pix, before) {
+			t.Errorf("XOR drawing twice over the tilemap did not restore it (indexed mode %d)", indexed)
+		}
+	}
+}
+
+func TestRendererConsole(t *testing.T) {
+	r := NewRenderer(16, 16)
+	r.Memory = []byte{0, 'A', 'B', '\n', 0}
+	r.Op(vm.NewOp(vm.OpPrintText, 0, 1))
+	r.Op(vm.NewOp(vm.OpPrintChar, 'C'))
+	if got, want := lines(&r.console), "AB"+strings.Repeat(".", ConsoleCols-2)+"\nC"; !strings.HasPrefix(got, want) {
+		t.Errorf("console text = %q, want it to start with %q", got, want)
+	}
+
+	if got := r.Frame().RGBAAt(1, 1); got != (color.RGBA{}) {
+		t.Errorf("pixel (1, 1) = %v before the console is shown, want transparent", got)
+	}
+
+	// The console is drawn in white on blue over the canvas
+	r.Op(vm.NewOp(vm.OpSetConsole, 1, 1, 6))
+	frame := r.Frame()
+	for y := range 8 {
+		for x := range 8 {
+			want := DefaultPalette[6]
+			if Glyph('A')[y]&(1<<x) != 0 {
+				want = DefaultPalette[1]
+			}
+			if got := frame.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	// The cursor inverts the blank cell after the 'C' on the second row
+	if got := frame.RGBAAt(8, 8); got != DefaultPalette[1] {
+		t.Errorf("cursor pixel (8, 8) = %v, want %v", got, DefaultPalette[1])
+	}
+
+	// On the default canvas, the cursor still shows on the last row, which is cut short
+	r = NewRenderer(255, 191)
+	r.ShowConsole(1, 0)
+	r.Op(vm.NewOp(vm.OpSetCursor, 0, ConsoleRows-1))
+	if got := r.Frame().RGBAAt(0, (ConsoleRows-1)*8); got != DefaultPalette[1] {
+		t.Errorf("cursor pixel on the last row = %v, want %v", got, DefaultPalette[1])
+	}
+}
@@ -0,0 +1,235 @@
+package gfx
+
+import "image"
+
+// Flags for the sprite drawing opcodes. The lowest two bits select the pixel format.
+const (
+	Sprite1Bit = 0 // 8 pixels per byte; palette indices 0 and 1
+	Sprite2Bit = 1 // 4 pixels per byte; palette indices 0 to 3
+	Sprite8Bit = 2 // 1 pixel per byte; palette indices 0 to 255
+
+	SpriteFlipX    = 1 << 2 // Mirror the sprite horizontally.
+	SpriteFlipY    = 1 << 3 // Mirror the sprite vertically.
+	SpriteColorKey = 1 << 4 // Skip pixels whose palette index equals the color key.
+
+	spriteFormatMask = 0b11
+)
+
+// Sprite is a bitmap of palette indices packed the way a program stores it in memory.
+// Rows are stored from top to bottom and each row starts on a new byte. Within a byte,
+// the leftmost pixel is in the most significant bits.
+type Sprite struct {
+	Data   []byte
+	W, H   int
+	Format int // One of Sprite1Bit, Sprite2Bit or Sprite8Bit
+}
+
+// bits returns the number of bits used by a single pixel.
+func (s Sprite) bits() int {
+	switch s.Format {
+	case Sprite1Bit:
+		return 1
+	case Sprite2Bit:
+		return 2
+	}
+	return 8
+}
+
+// Stride returns the number of bytes in each row of the sprite.
+func (s Sprite) Stride() int {
+	return (s.W*s.bits() + 7) / 8
+}
+
+// At returns the palette index of the pixel at (x, y) in the sprite. Pixels that lie past
+// the end of Data are 0.
+func (s Sprite) At(x, y int) byte {
+	bits := s.bits()
+	i := y*s.Stride() + x*bits/8
+	if i >= len(s.Data) {
+		return 0
+	}
+	shift := 8 - bits - x*bits%8
+	return s.Data[i] >> shift & (1<<bits - 1)
+}
+
+// Blit calls plot with the palette index of every pixel of the sprite, placing its
+// top-left corner at (x, y). The SpriteFlipX, SpriteFlipY and SpriteColorKey bits of flags
+// are applied; pixels matching key are skipped when SpriteColorKey is set.
+func Blit(s Sprite, x, y int, flags, key byte, plot func(x, y int, index byte)) {
+	for sy := range s.H {
+		for sx := range s.W {
+			index := s.At(sx, sy)
+			if flags&SpriteColorKey != 0 && index == key {
+				continue
+			}
+
+			dx, dy := sx, sy
+			if flags&SpriteFlipX != 0 {
+				dx = s.W - 1 - sx
+			}
+			if flags&SpriteFlipY != 0 {
+				dy = s.H - 1 - sy
+			}
+			plot(x+dx, y+dy, index)
+		}
+	}
+}
+
+// BlitTransformed is like Blit, but scales the sprite by scale/256 and rotates it clockwise
+// by angle 256ths of a turn around its center, which is placed at (x, y). Each pixel within
+// bounds that the transformed sprite covers is plotted once, with the index of the nearest
+// pixel of the sprite. Only integer math is used, so the result is the same on every machine.
+func BlitTransformed(s Sprite, x, y, scale int, angle, flags, key byte, bounds image.Rectangle, plot func(x, y int, index byte)) {
+	if scale <= 0 || s.W <= 0 || s.H <= 0 {
+		return
+	}
+	sin, cos := sine(angle), sine(angle+64)
+
+	// The transformed sprite lies within its circumscribed circle, whose radius is at most
+	// half of w+h. Only the part of its square within bounds is sampled.
+	radius := (s.W+s.H)*scale/512 + 1
+	for dy := max(-radius, bounds.Min.Y-y); dy <= min(radius, bounds.Max.Y-1-y); dy++ {
+		for dx := max(-radius, bounds.Min.X-x); dx <= min(radius, bounds.Max.X-1-x); dx++ {
+			// Rotate the center of the pixel back into the sprite, in half pixels and
+			// in units of 1/sineOne. The center of the sprite is at (W, H) half pixels.
+			u, v := 2*dx+1, 2*dy+1
+			su := (cos*u + sin*v) * 256
+			sv := (cos*v - sin*u) * 256
+			d := scale * sineOne
+			sx := floorDiv(su+s.W*d, 2*d)
+			sy := floorDiv(sv+s.H*d, 2*d)
+			if sx < 0 || sy < 0 || sx >= s.W || sy >= s.H {
+				continue
+			}
+
+			if flags&SpriteFlipX != 0 {
+				sx = s.W - 1 - sx
+			}
+			if flags&SpriteFlipY != 0 {
+				sy = s.H - 1 - sy
+			}
+			index := s.At(sx, sy)
+			if flags&SpriteColorKey != 0 && index == key {
+				continue
+			}
+			plot(x+dx, y+dy, index)
+		}
+	}
+}
+
+// sineOne is the value of sine for a quarter turn.
+const sineOne = 16384
+
+// quarterSine holds sine(a) for the first quarter turn, from a = 0 to 64.
+var quarterSine = [65]int{
+	0, 402, 804, 1205, 1606, 2006, 2404, 2801,
+	3196, 3590, 3981, 4370, 4756, 5139, 5520, 5897,
+	6270, 6639, 7005, 7366, 7723, 8076, 8423, 8765,
+	9102, 9434, 9760, 10080, 10394, 10702, 11003, 11297,
+	11585, 11866, 12140, 12406, 12665, 12916, 13160, 13395,
+	13623, 13842, 14053, 14256, 14449, 14635, 14811, 14978,
+	15137, 15286, 15426, 15557, 15679, 15791, 15893, 15986,
+	16069, 16143, 16207, 16261, 16305, 16340, 16364, 16379,
+	16384,
+}
+
+// sine returns the sine of angle 256ths of a turn, multiplied by sineOne and rounded.
+func sine(angle byte) int {
+	a := int(angle)
+	switch {
+	case a <= 64:
+		return quarterSine[a]
+	case a <= 128:
+		return quarterSine[128-a]
+	case a <= 192:
+		return -quarterSine[a-128]
+	}
+	return -quarterSine[256-a]
+}
+
+// SpriteEnabled is the flag that shows an entry of a SpriteTable.
+const SpriteEnabled = 1 << 7
+
+// SpriteCount is the number of entries in a SpriteTable.
+const SpriteCount = 64
+
+// SpriteTable is a table of hardware sprites that the host draws every frame, so that a
+// program moves a sprite by changing its entry rather than by erasing and redrawing it.
+//
+// Memory begins with SpriteCount entries of 4 bytes: x, y, tile and flags. The flags are
+// those of the sprite drawing opcodes along with SpriteEnabled; the pixel format is that of
+// the table. Tile n is the 8x8 Sprite at Tiles[n*size:], as for a Tilemap. The entries are
+// followed by SpriteCount/8 bytes of collision bits, written by Draw.
+//
+// The entries of a Wide table are 6 bytes instead, with x and y as signed 2 byte values,
+// so that sprites can reach every pixel of a canvas larger than 255x255.
+type SpriteTable struct {
+	Memory []byte
+	Tiles  []byte
+	Format int // Pixel format of the tiles; one of Sprite1Bit, Sprite2Bit or Sprite8Bit.
+	Wide   bool
+}
+
+// Draw calls plot for every pixel of the enabled sprites that lies within bounds. Sprites
+// with a lower number are drawn last, so they appear in front. Pixels with the palette
+// index 0 are skipped for sprites with the SpriteColorKey flag.
+//
+// Draw then stores the collision bits after the entries: bit n%8 of byte n/8 is set if an
+// opaque pixel of sprite n overlaps one of another sprite within bounds.
+func (t SpriteTable) Draw(bounds image.Rectangle, plot func(x, y int, index byte)) {
+	var collisions [SpriteCount / 8]byte
+
+	// The number of the sprite drawn at each pixel of bounds, plus one.
+	owners := make([]byte, bounds.Dx()*bounds.Dy())
+
+	for n := SpriteCount - 1; n >= 0; n-- {
+		x, y, number, flags := t.entry(n)
+		if flags&SpriteEnabled == 0 {
+			continue
+		}
+
+		tile := Sprite{W: 8, H: 8, Format: t.Format}
+		start := int(number) * tile.Stride() * 8
+		if start < len(t.Tiles) {
+			tile.Data = t.Tiles[start:]
+		}
+		Blit(tile, x, y, flags, 0, func(x, y int, index byte) {
+			if !image.Pt(x, y).In(bounds) {
+				return
+			}
+			i := (y-bounds.Min.Y)*bounds.Dx() + x - bounds.Min.X
+			if owner := owners[i]; owner != 0 {
+				collisions[n/8] |= 1 << (n % 8)
+				collisions[(owner-1)/8] |= 1 << ((owner - 1) % 8)
+			}
+			owners[i] = byte(n + 1)
+			plot(x, y, index)
+		})
+	}
+
+	if size := SpriteCount * t.entrySize(); len(t.Memory) > size {
+		copy(t.Memory[size:], collisions[:])
+	}
+}
+
+// entrySize returns the number of bytes of an entry.
+func (t SpriteTable) entrySize() int {
+	if t.Wide {
+		return 6
+	}
+	return 4
+}
+
+// entry returns the fields of the nth entry, whose bytes are 0 past the end of Memory.
+func (t SpriteTable) entry(n int) (x, y int, tile, flags byte) {
+	var entry [6]byte
+	if start := n * t.entrySize(); start < len(t.Memory) {
+		copy(entry[:t.entrySize()], t.Memory[start:])
+	}
+	if !t.Wide {
+		return int(entry[0]), int(entry[1]), entry[2], entry[3]
+	}
+	x = int(int16(uint16(entry[0])<<8 | uint16(entry[1])))
+	y = int(int16(uint16(entry[2])<<8 | uint16(entry[3])))
+	return x, y, entry[4], entry[5]
+}
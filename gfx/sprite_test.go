@@ -0,0 +1,191 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestSpriteAt(t *testing.T) {
+	table := []struct {
+		name   string
+		sprite Sprite
+		want   string // Palette indices as digits, one row per line
+	}{
+		{
+			name:   "1-bit",
+			sprite: Sprite{Data: []byte{0b1010_0000, 0b0110_0000}, W: 3, H: 2, Format: Sprite1Bit},
+			want:   "101\n011\n",
+		},
+		{
+			name:   "2-bit",
+			sprite: Sprite{Data: []byte{0b00_01_10_11, 0b10_00_00_00}, W: 5, H: 1, Format: Sprite2Bit},
+			want:   "01232\n",
+		},
+		{
+			name:   "8-bit",
+			sprite: Sprite{Data: []byte{9, 8, 7, 6}, W: 2, H: 2, Format: Sprite8Bit},
+			want:   "98\n76\n",
+		},
+		{
+			name:   "short data",
+			sprite: Sprite{Data: []byte{5}, W: 2, H: 1, Format: Sprite8Bit},
+			want:   "50\n",
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			for y := range test.sprite.H {
+				for x := range test.sprite.W {
+					sb.WriteByte('0' + test.sprite.At(x, y))
+				}
+				sb.WriteByte('\n')
+			}
+			if got := sb.String(); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBlit(t *testing.T) {
+	sprite := Sprite{Data: []byte{0b1100_0000, 0b1000_0000}, W: 3, H: 2, Format: Sprite1Bit}
+
+	table := []struct {
+		name  string
+		flags byte
+		want  string
+	}{
+		{name: "opaque", flags: 0, want: ".......\n.###...\n.###...\n"},
+		{name: "color key", flags: SpriteColorKey, want: ".......\n.##....\n.#.....\n"},
+		{name: "flip x", flags: SpriteColorKey | SpriteFlipX, want: ".......\n..##...\n...#...\n"},
+		{name: "flip y", flags: SpriteColorKey | SpriteFlipY, want: ".......\n.#.....\n.##....\n"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			got := grid(t, 7, 3, func(plot func(x, y int)) {
+				Blit(sprite, 1, 1, test.flags, 0, func(x, y int, index byte) {
+					plot(x, y)
+				})
+			})
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSpriteTable(t *testing.T) {
+	memory := make([]byte, SpriteCount*4+SpriteCount/8)
+	copy(memory, []byte{
+		0, 0, 0, SpriteEnabled | SpriteColorKey, // Sprite 0
+		1, 1, 1, SpriteEnabled | SpriteColorKey, // Sprite 1, behind sprite 0
+		6, 0, 2, SpriteEnabled, // Sprite 2, opaque
+		3, 0, 0, 0, // Sprite 3, disabled
+	})
+	memory[SpriteCount*4+1] = 0xFF // Stale collision bits are overwritten
+
+	tiles := make([]byte, 3*16)
+	copy(tiles[0:], []byte{0b01_01_00_00, 0, 0b01_01_00_00, 0})  // 2x2 block of 1s
+	copy(tiles[16:], []byte{0b10_10_00_00, 0, 0b10_10_00_00, 0}) // 2x2 block of 2s
+	table := SpriteTable{Memory: memory, Tiles: tiles, Format: Sprite2Bit}
+
+	got := bytes.Repeat([]byte{'.'}, 8*3)
+	table.Draw(image.Rect(0, 0, 8, 3), func(x, y int, index byte) {
+		got[y*8+x] = '0' + index
+	})
+	want := "" +
+		"11....00" +
+		"112...00" +
+		".22...00"
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	collisions := memory[SpriteCount*4:]
+	if collisions[0] != 0b011 || collisions[1] != 0 {
+		t.Errorf("collision bits = %08b, want [00000011 00000000 ...]", collisions)
+	}
+
+	// The entries of a wide table have 16-bit coordinates
+	memory = make([]byte, SpriteCount*6+SpriteCount/8)
+	copy(memory, []byte{
+		0x01, 0x2E, 0xFF, 0xFF, 1, SpriteEnabled | SpriteColorKey, // Sprite 0 at (302, -1)
+		0x01, 0x2F, 0x00, 0x00, 1, SpriteEnabled | SpriteColorKey, // Sprite 1 at (303, 0)
+	})
+	table = SpriteTable{Memory: memory, Tiles: tiles, Format: Sprite2Bit, Wide: true}
+	got = bytes.Repeat([]byte{'.'}, 8*3)
+	table.Draw(image.Rect(300, 0, 308, 3), func(x, y int, index byte) {
+		got[y*8+x-300] = '0' + index
+	})
+	want = "" +
+		"..222..." +
+		"...22..." +
+		"........"
+	if string(got) != want {
+		t.Errorf("wide table: got %s, want %s", got, want)
+	}
+	if collisions := memory[SpriteCount*6:]; collisions[0] != 0b11 {
+		t.Errorf("wide table: collision bits = %08b, want [00000011 ...]", collisions)
+	}
+}
+
+func TestBlitTransformed(t *testing.T) {
+	sprite := Sprite{Data: []byte{1, 2, 3, 4}, W: 2, H: 2, Format: Sprite8Bit}
+
+	table := []struct {
+		name         string
+		scale        int
+		angle, flags byte
+		want         string // Palette indices as digits, one row per line
+	}{
+		{name: "identity", scale: 256, want: "0000\n0120\n0340\n0000\n"},
+		{name: "quarter turn", scale: 256, angle: 64, want: "0000\n0310\n0420\n0000\n"},
+		{name: "half turn", scale: 256, angle: 128, want: "0000\n0430\n0210\n0000\n"},
+		{name: "three quarter turn", scale: 256, angle: 192, want: "0000\n0240\n0130\n0000\n"},
+		{name: "flip x", scale: 256, flags: SpriteFlipX, want: "0000\n0210\n0430\n0000\n"},
+		{name: "double", scale: 512, want: "1122\n1122\n3344\n3344\n"},
+		{name: "half", scale: 128, want: "0000\n0100\n0000\n0000\n"},
+		{name: "zero scale", scale: 0, want: "0000\n0000\n0000\n0000\n"},
+		{name: "color key", scale: 512, flags: SpriteColorKey, want: "0022\n0022\n3344\n3344\n"},
+		{name: "largest scale", scale: 0xFFFF, want: "1122\n1122\n3344\n3344\n"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var pixels [4][4]byte
+			bounds := image.Rect(0, 0, 4, 4)
+			BlitTransformed(sprite, 2, 2, test.scale, test.angle, test.flags, 1, bounds, func(x, y int, index byte) {
+				if pixels[y][x] != 0 {
+					t.Errorf("pixel (%d, %d) was plotted twice", x, y)
+				}
+				pixels[y][x] = index
+			})
+
+			var sb strings.Builder
+			for _, row := range pixels {
+				for _, index := range row {
+					sb.WriteByte('0' + index)
+				}
+				sb.WriteByte('\n')
+			}
+			if got := sb.String(); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSine(t *testing.T) {
+	for angle := range 256 {
+		sin, cos := sine(byte(angle)), sine(byte(angle+64))
+		// sin² + cos² = 1, within the rounding of the table
+		if d := sin*sin + cos*cos - sineOne*sineOne; d < -2*sineOne || d > 2*sineOne {
+			t.Errorf("sine(%d)² + sine(%d)² is off by %d", angle, angle+64, d)
+		}
+	}
+}
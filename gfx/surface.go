@@ -0,0 +1,118 @@
+package gfx
+
+import (
+	"image"
+	"image/color"
+)
+
+const (
+	maxSurfaces    = 16   // The number of surfaces, including the canvas.
+	maxSurfaceSize = 2048 // The largest width and height of an offscreen surface.
+)
+
+// surface is an image that drawing operations can target. Surface 0 is the canvas, and the
+// others are offscreen surfaces allocated by the program with OpNewSurface.
+type surface struct {
+	image *image.RGBA
+
+	// indices holds one palette index per pixel of image. It is nil unless the program has
+	// enabled the indexed mode with OpSetIndexedMode, in which case drawing operations
+	// write to it and image is only updated by recolor.
+	indices []byte
+}
+
+func newSurface(width, height int, indexed bool) *surface {
+	s := &surface{image: image.NewRGBA(image.Rect(0, 0, width, height))}
+	s.setIndexed(indexed)
+	return s
+}
+
+// setIndexed enables or disables the indexed mode of s. When it is disabled, the pixels of
+// image are left as they were last recolored.
+func (s *surface) setIndexed(indexed bool) {
+	if !indexed {
+		s.indices = nil
+	} else if s.indices == nil {
+		s.indices = make([]byte, len(s.image.Pix)/4)
+	}
+}
+
+// recolor updates image from indices using palette, if s is in the indexed mode.
+func (s *surface) recolor(palette *[256]color.RGBA) {
+	for i, index := range s.indices {
+		c := palette[index]
+		pix := s.image.Pix[i*4 : i*4+4]
+		pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, c.A
+	}
+}
+
+func (s *surface) clear() {
+	clear(s.image.Pix)
+	clear(s.indices)
+}
+
+// set sets the pixel at (x, y) to c, or to the palette index in the indexed mode. Pixels
+// outside the surface are discarded.
+func (s *surface) set(x, y int, index byte, c color.RGBA) {
+	if s.indices == nil {
+		s.image.SetRGBA(x, y, c)
+		return
+	}
+	if image.Pt(x, y).In(s.image.Rect) {
+		s.indices[y*s.image.Rect.Dx()+x] = index
+	}
+}
+
+// blend draws c, or the palette index in the indexed mode, onto the pixel at (x, y) in the
+// given blend mode. Pixels outside the surface are discarded.
+func (s *surface) blend(x, y int, index byte, c color.RGBA, palette *[256]color.RGBA, mode byte) {
+	if !image.Pt(x, y).In(s.image.Rect) {
+		return
+	}
+	if s.indices == nil {
+		s.image.SetRGBA(x, y, Blend(s.image.RGBAAt(x, y), c, mode))
+		return
+	}
+	i := y*s.image.Rect.Dx() + x
+	s.indices[i] = BlendIndex(s.indices[i], index, palette, mode)
+}
+
+// at returns the color of the pixel at (x, y), which is transparent outside the surface.
+func (s *surface) at(x, y int, palette *[256]color.RGBA) color.RGBA {
+	if s.indices == nil || !image.Pt(x, y).In(s.image.Rect) {
+		return s.image.RGBAAt(x, y)
+	}
+	return palette[s.indices[y*s.image.Rect.Dx()+x]]
+}
+
+// copyRect replaces the pixels of dst in the rectangle of the given size at dp with those
+// of src at sp, or their palette indices in the indexed mode. The rectangle is clipped to
+// both surfaces, and src and dst may be the same surface.
+func copyRect(dst *surface, dp image.Point, src *surface, sp image.Point, size image.Point) {
+	// Clip the source rectangle to both surfaces, in source coordinates
+	r := image.Rectangle{Min: sp, Max: sp.Add(size)}.Intersect(src.image.Rect)
+	r = r.Intersect(dst.image.Rect.Add(sp.Sub(dp)))
+	if r.Empty() {
+		return
+	}
+	dp = dp.Add(r.Min.Sub(sp))
+
+	// Every surface is in the same mode, so copy either the indices or the pixels
+	pix, bpp := src.image.Pix, 4
+	dstPix, srcW, dstW := dst.image.Pix, src.image.Rect.Dx(), dst.image.Rect.Dx()
+	if src.indices != nil {
+		pix, bpp, dstPix = src.indices, 1, dst.indices
+	}
+
+	// Copy through a buffer in case the rectangles overlap
+	rowLen := r.Dx() * bpp
+	buf := make([]byte, rowLen*r.Dy())
+	for y := range r.Dy() {
+		i := ((r.Min.Y+y)*srcW + r.Min.X) * bpp
+		copy(buf[y*rowLen:], pix[i:i+rowLen])
+	}
+	for y := range r.Dy() {
+		i := ((dp.Y+y)*dstW + dp.X) * bpp
+		copy(dstPix[i:i+rowLen], buf[y*rowLen:])
+	}
+}
@@ -0,0 +1,16 @@
+package gfx
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestCopyRectOverlap(t *testing.T) {
+	s := newSurface(4, 1, true)
+	copy(s.indices, []byte{1, 2, 3, 4})
+	copyRect(s, image.Pt(1, 0), s, image.Pt(0, 0), image.Pt(3, 1))
+	if want := []byte{1, 1, 2, 3}; !bytes.Equal(s.indices, want) {
+		t.Errorf("indices = %v, want %v", s.indices, want)
+	}
+}
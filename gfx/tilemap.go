@@ -0,0 +1,38 @@
+package gfx
+
+// Tilemap is a background layer built from 8x8 tiles. Map holds the tile number of every
+// cell of the layer, row by row, and tile n is the 8x8 Sprite stored at Tiles[n*size:],
+// where size is the number of bytes in a tile of the given Format.
+type Tilemap struct {
+	Map    []byte
+	Tiles  []byte
+	W, H   int // Size of the map in tiles.
+	Format int // Pixel format of the tiles; one of Sprite1Bit, Sprite2Bit or Sprite8Bit.
+}
+
+// At returns the palette index of the pixel at (x, y) in the layer, which repeats in both
+// directions so that it can be scrolled endlessly. Cells or tiles that lie past the end of
+// Map or Tiles read as 0.
+func (t Tilemap) At(x, y int) byte {
+	width, height := t.W*8, t.H*8
+	if width == 0 || height == 0 {
+		return 0
+	}
+	x, y = mod(x, width), mod(y, height)
+
+	cell := y/8*t.W + x/8
+	if cell >= len(t.Map) {
+		return 0
+	}
+	tile := Sprite{W: 8, H: 8, Format: t.Format}
+	start := int(t.Map[cell]) * tile.Stride() * 8
+	if start < len(t.Tiles) {
+		tile.Data = t.Tiles[start:]
+	}
+	return tile.At(x%8, y%8)
+}
+
+// mod returns the remainder of a / b, which unlike a % b is never negative.
+func mod(a, b int) int {
+	return (a%b + b) % b
+}
@@ -0,0 +1,38 @@
+package gfx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTilemapAt(t *testing.T) {
+	tiles := []byte{
+		0, 0, 0, 0, 0, 0, 0, 0, // Tile 0 is blank
+		0xFF, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0xFF, // Tile 1 is a box
+	}
+	tm := Tilemap{Map: []byte{1, 0}, Tiles: tiles, W: 2, H: 1, Format: Sprite1Bit}
+
+	table := []struct {
+		name string
+		x, y int
+		want string // The first row of 16 pixels starting at (x, y)
+	}{
+		{name: "origin", x: 0, y: 0, want: "1111111100000000"},
+		{name: "second row", x: 0, y: 1, want: "1000000100000000"},
+		{name: "scrolled", x: 4, y: 0, want: "1111000000001111"},
+		{name: "wraps", x: 16, y: 8, want: "1111111100000000"},
+		{name: "negative", x: -8, y: -7, want: "0000000010000001"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			for x := range 16 {
+				sb.WriteByte('0' + tm.At(test.x+x, test.y))
+			}
+			if got := sb.String(); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/fivemoreminix/bf8/gfx"
+	"github.com/fivemoreminix/bf8/sound"
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+// runHeadless runs program on a width×height screen without opening a window, and writes
+// the frame displayed after the given number of frames to a PNG file at outputName. If
+// wavName is not empty, the audio of those frames is written to a WAV file at wavName.
+//
+// Unlike the window, a headless frame runs the program for exactly instructionsPerFrame
+// instructions (or until it terminates, or waits for the next frame with OpPresent), and
+// handles every Operation that they send. This makes the saved frame independent of how
+// fast the host machine is. There is no input, so the input devices are left out.
+func runHeadless(program *vm.Program, width, height, frames int, outputName, wavName string) error {
+	opChan := make(chan vm.Op, 256)
+	stepped := program.Stepped()
+	defer program.Stop()
+	go func() {
+		program.Run(opChan)
+		close(opChan)
+	}()
+
+	renderer := gfx.NewRenderer(width, height)
+	renderer.Memory = program.DataSection()
+	if program.Classic {
+		program.Output = renderer.ShowConsole(1, 0)
+	}
+	frame := renderer.Canvas()
+	synth := sound.NewSynth()
+	synth.Memory = program.DataSection()
+	music := sound.NewSequencer(synth)
+	music.Memory = program.DataSection()
+	devices := []device{renderer, synth, music}
+	var pcm []byte
+
+	vsync, done := false, false
+	for range frames {
+		if !done {
+			// The step must be given first, so that a program waiting for this frame does
+			// not run on what was left of the last one
+			program.Step(instructionsPerFrame)
+		}
+		if vsync {
+			vsync = false
+			program.Resume(nil)
+		}
+	step:
+		for !done {
+			select {
+			case op, ok := <-opChan:
+				if !ok {
+					done = true // The program has terminated
+					break step
+				}
+				if vsync = handleOp(devices, program, op); vsync {
+					break step // The program waits for the next frame
+				}
+			case <-stepped:
+				// The program waits for the next step, after sending the rest of the
+				// Operations of this one, none of which are Sync
+				for len(opChan) > 0 {
+					handleOp(devices, program, <-opChan)
+				}
+				break step
+			}
+		}
+
+		program.Lock()
+		frame = renderer.Frame()
+		music.Update()
+		program.Unlock()
+
+		// The audio of a frame always has the same length, so it is independent of the
+		// speed of the host machine like the frame itself.
+		samples := make([]byte, sound.FrameSamples*4)
+		synth.Read(samples)
+		pcm = append(pcm, samples...)
+	}
+
+	if wavName != "" {
+		if err := writeFile(wavName, func(w io.Writer) error { return sound.WriteWAV(w, pcm) }); err != nil {
+			return err
+		}
+	}
+	return writeFile(outputName, func(w io.Writer) error { return png.Encode(w, frame) })
+}
+
+// writeFile creates the file at name and writes it with write.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
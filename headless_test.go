@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fivemoreminix/bf8/gfx"
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+func TestRunHeadlessFramebuffer(t *testing.T) {
+	// Maps the framebuffer to cell 16 and colors its first pixel, then counts up in the
+	// second pixel forever without sending another Op.
+	code := ">" + strings.Repeat("+", 16) + ">+++>" + strings.Repeat("+", int(vm.OpSetFramebuffer)) + "." +
+		strings.Repeat(">", 13) + "+[>+<]"
+
+	run := func(name string) []byte {
+		program, err := vm.NewProgram([]byte(code))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := filepath.Join(t.TempDir(), name)
+		if err := runHeadless(program, 8, 8, 10, output, ""); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := run("first.png")
+	if second := run("second.png"); !bytes.Equal(first, second) {
+		t.Error("two headless runs of the same cart saved different frames")
+	}
+
+	frame, err := png.Decode(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The setup takes 10 instructions, as a run of '+' or '>' is one instruction, and then
+	// the second of every 4 instructions of the loop counts up
+	count := byte((instructionsPerFrame*10 - 10 + 2) / 4)
+	for x, index := range []byte{1, count, 0} {
+		if got, want := color.RGBAModel.Convert(frame.At(x, 0)), gfx.DefaultPalette[index]; got != want {
+			t.Errorf("pixel (%d, 0) = %v, want %v", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package input
+
+import "github.com/fivemoreminix/bf8/vm"
+
+// Key is one of the keys of the Keyboard, numbered by the order of their cells.
+type Key int
+
+const (
+	KeyUp Key = iota
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyZ
+	KeyX
+	KeyC
+	KeyV
+	KeyA
+	KeyS
+	KeyD
+	KeyW
+	KeyQ
+	KeyE
+	KeySpace
+	KeyEnter
+	KeyEscape
+	KeyTab
+	KeyBackspace
+	KeyShift
+	KeyControl
+	KeyAlt
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+
+	KeyCount = iota // The number of keys, and of cells in the memory region of a Keyboard.
+)
+
+// Bits of the cell of a key.
+const (
+	KeyHeld     = 1 << 0 // The key is held down.
+	KeyPressed  = 1 << 1 // The key was pressed since the last frame.
+	KeyReleased = 1 << 2 // The key was released since the last frame.
+)
+
+// Keyboard is the keyboard device. Once a program enables it with OpSetKeyboard, the host
+// stores the state of every Key in a region of the program's memory each frame, so that
+// the program can read it with plain Brainfuck. The region holds one cell per Key, in the
+// order of the Key constants, made of the KeyHeld, KeyPressed and KeyReleased bits.
+type Keyboard struct {
+	// Memory is the data section of the program, which the key states are written to.
+	Memory []byte
+
+	region []byte // The part of Memory that holds the key states, or nil when disabled.
+}
+
+// Op applies an operation to the keyboard device and returns the bytes that it outputs to
+// the program, if any. Operations that are not for the keyboard are ignored.
+func (k *Keyboard) Op(op vm.Op) (out []byte) {
+	switch op.Code {
+	case vm.OpSetKeyboard:
+		addr := int(op.Word(1))
+		if op.Byte(0) == 0 || addr >= len(k.Memory) {
+			k.region = nil
+			break
+		}
+		k.region = k.Memory[addr:min(addr+KeyCount, len(k.Memory))]
+	}
+	return nil
+}
+
+// Update stores state, the bits of every Key, in the memory region of the keyboard if the
+// program has enabled it. The host calls Update once per frame while the Program is locked.
+func (k *Keyboard) Update(state [KeyCount]byte) {
+	copy(k.region, state[:])
+}
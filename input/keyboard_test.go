@@ -0,0 +1,38 @@
+package input
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+func TestKeyboard(t *testing.T) {
+	memory := make([]byte, 64)
+	k := &Keyboard{Memory: memory}
+
+	var state [KeyCount]byte
+	state[KeyUp] = KeyHeld | KeyPressed
+	state[Key9] = KeyReleased
+
+	k.Update(state) // Disabled, so nothing is stored
+	if !bytes.Equal(memory, make([]byte, 64)) {
+		t.Fatal("Update stored the key states before OpSetKeyboard")
+	}
+
+	k.Op(vm.NewOp(vm.OpSetKeyboard, 0, 16, 1)) // Memory[16:]
+	k.Update(state)
+	if got := memory[16 : 16+KeyCount]; !bytes.Equal(got, state[:]) {
+		t.Errorf("key states = %v, want %v", got, state)
+	}
+	if memory[15] != 0 || memory[16+KeyCount] != 0 {
+		t.Error("Update stored key states outside of its region")
+	}
+
+	// A region that runs past the end of Memory is cut short
+	k.Op(vm.NewOp(vm.OpSetKeyboard, 0, 60, 1))
+	k.Update(state)
+	if got := memory[60:]; !bytes.Equal(got, state[:4]) {
+		t.Errorf("key states at the end of memory = %v, want %v", got, state[:4])
+	}
+}
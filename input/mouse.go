@@ -0,0 +1,59 @@
+package input
+
+import "github.com/fivemoreminix/bf8/vm"
+
+// Bits of the button cells of the Mouse.
+const (
+	MouseLeft   = 1 << 0
+	MouseRight  = 1 << 1
+	MouseMiddle = 1 << 2
+	MouseOver   = 1 << 7 // The cursor is over the canvas; only in the held buttons cell.
+)
+
+// MouseSize is the number of cells in the memory region of a Mouse.
+const MouseSize = 7
+
+// MouseState is the state of the mouse during a frame.
+type MouseState struct {
+	X, Y    int  // The cursor position in canvas coordinates, within the canvas.
+	Held    byte // The buttons held down, and MouseOver.
+	Pressed byte // The buttons pressed since the last frame.
+	Wheel   int  // The vertical wheel steps since the last frame; positive is up.
+}
+
+// Mouse is the mouse device. Once a program enables it with OpSetMouse, the host stores
+// the state of the mouse in a region of the program's memory each frame. The region holds
+// MouseSize cells: x (2 byte), y (2 byte), the held buttons, the pressed buttons and the
+// wheel steps (signed, saturating at -128 and 127).
+type Mouse struct {
+	// Memory is the data section of the program, which the mouse state is written to.
+	Memory []byte
+
+	region []byte // The part of Memory that holds the mouse state, or nil when disabled.
+}
+
+// Op applies an operation to the mouse device and returns the bytes that it outputs to
+// the program, if any. Operations that are not for the mouse are ignored.
+func (m *Mouse) Op(op vm.Op) (out []byte) {
+	switch op.Code {
+	case vm.OpSetMouse:
+		addr := int(op.Word(1))
+		if op.Byte(0) == 0 || addr >= len(m.Memory) {
+			m.region = nil
+			break
+		}
+		m.region = m.Memory[addr:min(addr+MouseSize, len(m.Memory))]
+	}
+	return nil
+}
+
+// Update stores state in the memory region of the mouse if the program has enabled it.
+// The host calls Update once per frame while the Program is locked.
+func (m *Mouse) Update(state MouseState) {
+	wheel := int8(max(-128, min(state.Wheel, 127)))
+	copy(m.region, []byte{
+		byte(state.X >> 8), byte(state.X),
+		byte(state.Y >> 8), byte(state.Y),
+		state.Held, state.Pressed, byte(wheel),
+	})
+}
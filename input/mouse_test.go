@@ -0,0 +1,41 @@
+package input
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+func TestMouse(t *testing.T) {
+	memory := make([]byte, 16)
+	m := &Mouse{Memory: memory}
+
+	m.Op(vm.NewOp(vm.OpSetMouse, 0, 1, 1)) // Memory[1:]
+
+	table := []struct {
+		state MouseState
+		want  []byte
+	}{
+		{
+			state: MouseState{X: 300, Y: 2, Held: MouseOver | MouseLeft, Pressed: MouseLeft, Wheel: 1},
+			want:  []byte{0, 1, 44, 0, 2, MouseOver | MouseLeft, MouseLeft, 1, 0},
+		},
+		{
+			state: MouseState{Held: MouseRight, Wheel: -500},
+			want:  []byte{0, 0, 0, 0, 0, MouseRight, 0, 0x80, 0},
+		},
+	}
+	for _, test := range table {
+		m.Update(test.state)
+		if got := memory[:MouseSize+2]; !bytes.Equal(got, test.want) {
+			t.Errorf("Update(%+v) stored %v, want %v", test.state, got, test.want)
+		}
+	}
+
+	m.Op(vm.NewOp(vm.OpSetMouse, 0, 1, 0))
+	m.Update(MouseState{X: 1, Y: 1})
+	if memory[2] != 0 {
+		t.Error("Update stored the mouse state after disabling the mouse")
+	}
+}
@@ -0,0 +1,58 @@
+package input
+
+// textBufferSize is the number of typed characters that a TextInput holds until they are
+// read.
+const textBufferSize = 256
+
+// TextInput is the stream of characters typed into the window. It is an io.Reader, which
+// the host sets as the Input of the Program so that the ',' instruction reads from it.
+type TextInput struct {
+	chars chan byte
+
+	// Wait makes Read wait until a character has been typed. Otherwise Read gives a single
+	// 0 when none has, so that a ',' does not stop a cart that does not expect input, such
+	// as one with "Hello, world" in a comment. The host only sets it for classic carts.
+	Wait bool
+}
+
+func NewTextInput() *TextInput {
+	return &TextInput{chars: make(chan byte, textBufferSize)}
+}
+
+// Type adds text to the stream. Characters that do not fit in the buffer are dropped, so
+// that the host never waits for the program to read them.
+func (t *TextInput) Type(text []byte) {
+	for _, c := range text {
+		select {
+		case t.chars <- c:
+		default:
+			return
+		}
+	}
+}
+
+// Read reads the typed characters into p. If there are none, it waits for one when Wait is
+// set, and gives a 0 otherwise.
+func (t *TextInput) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if t.Wait {
+		p[0] = <-t.chars
+	} else {
+		select {
+		case p[0] = <-t.chars:
+		default:
+			p[0] = 0
+			return 1, nil
+		}
+	}
+	for n = 1; n < len(p); n++ {
+		select {
+		case p[n] = <-t.chars:
+		default:
+			return n, nil
+		}
+	}
+	return n, nil
+}
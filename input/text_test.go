@@ -0,0 +1,76 @@
+package input
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+func TestTextInput(t *testing.T) {
+	text := NewTextInput()
+	text.Wait = true
+	text.Type([]byte("hi"))
+
+	buf := make([]byte, 4)
+	if n, err := text.Read(buf); err != nil || !bytes.Equal(buf[:n], []byte("hi")) {
+		t.Fatalf("Read = %q, %v, want %q", buf[:n], err, "hi")
+	}
+
+	// Read waits until something is typed
+	done := make(chan byte)
+	go func() {
+		var c [1]byte
+		text.Read(c[:])
+		done <- c[0]
+	}()
+	select {
+	case <-done:
+		t.Fatal("Read returned before anything was typed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	text.Type([]byte("!"))
+	if c := <-done; c != '!' {
+		t.Errorf("Read = %q, want '!'", c)
+	}
+
+	// Typing more than the buffer holds drops the rest
+	text.Type(bytes.Repeat([]byte("x"), textBufferSize+10))
+	buf = make([]byte, textBufferSize*2)
+	if n, _ := text.Read(buf); n != textBufferSize {
+		t.Errorf("Read %d bytes after overflowing the buffer, want %d", n, textBufferSize)
+	}
+}
+
+func TestTextInputNoWait(t *testing.T) {
+	text := NewTextInput()
+	buf := make([]byte, 4)
+	if n, err := text.Read(buf); err != nil || !bytes.Equal(buf[:n], []byte{0}) {
+		t.Fatalf("Read = %q, %v before anything was typed, want a single 0", buf[:n], err)
+	}
+	text.Type([]byte("hi"))
+	if n, err := text.Read(buf); err != nil || !bytes.Equal(buf[:n], []byte("hi")) {
+		t.Fatalf("Read = %q, %v, want %q", buf[:n], err, "hi")
+	}
+
+	// A graphics cart with a ',' in its text runs to its end without anything typed
+	p, err := vm.NewProgram([]byte("+++ Hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Input = text
+	done := make(chan error)
+	go func() { done <- p.Run(nil) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the cart waited for input")
+	}
+	if got := p.DataSection()[0]; got != 0 {
+		t.Errorf("cell 0 = %d, want the 0 read by ','", got)
+	}
+}
@@ -1,27 +1,106 @@
 package main
 
 import (
-	"image/color"
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"io"
 	"os"
 	"time"
 
+	"github.com/fivemoreminix/bf8/gfx"
+	"github.com/fivemoreminix/bf8/input"
+	"github.com/fivemoreminix/bf8/sound"
 	"github.com/fivemoreminix/bf8/vm"
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 const (
-	screenWidth, screenHeight = 255, 191
+	// The screen size used when neither the cart's "@size" metadata nor the -size flag
+	// gives one.
+	defaultWidth, defaultHeight = 255, 191
+	maxScreenSize               = 2048 // The largest width and height, as for offscreen surfaces.
+
+	clockRate   = time.Millisecond // The time that the window takes to run an instruction.
+	opsPerFrame = 60               // The most Operations handled in one Update.
+
+	// instructionsPerFrame is the number of instructions in a headless frame, as many as
+	// the window runs in a frame at its clock rate.
+	instructionsPerFrame = int(time.Second / clockRate / 60)
 )
 
+// keyMap holds the ebiten key of every key of the keyboard device.
+var keyMap = [input.KeyCount]ebiten.Key{
+	input.KeyUp:        ebiten.KeyArrowUp,
+	input.KeyDown:      ebiten.KeyArrowDown,
+	input.KeyLeft:      ebiten.KeyArrowLeft,
+	input.KeyRight:     ebiten.KeyArrowRight,
+	input.KeyZ:         ebiten.KeyZ,
+	input.KeyX:         ebiten.KeyX,
+	input.KeyC:         ebiten.KeyC,
+	input.KeyV:         ebiten.KeyV,
+	input.KeyA:         ebiten.KeyA,
+	input.KeyS:         ebiten.KeyS,
+	input.KeyD:         ebiten.KeyD,
+	input.KeyW:         ebiten.KeyW,
+	input.KeyQ:         ebiten.KeyQ,
+	input.KeyE:         ebiten.KeyE,
+	input.KeySpace:     ebiten.KeySpace,
+	input.KeyEnter:     ebiten.KeyEnter,
+	input.KeyEscape:    ebiten.KeyEscape,
+	input.KeyTab:       ebiten.KeyTab,
+	input.KeyBackspace: ebiten.KeyBackspace,
+	input.KeyShift:     ebiten.KeyShift,
+	input.KeyControl:   ebiten.KeyControl,
+	input.KeyAlt:       ebiten.KeyAlt,
+	input.Key0:         ebiten.KeyDigit0,
+	input.Key1:         ebiten.KeyDigit1,
+	input.Key2:         ebiten.KeyDigit2,
+	input.Key3:         ebiten.KeyDigit3,
+	input.Key4:         ebiten.KeyDigit4,
+	input.Key5:         ebiten.KeyDigit5,
+	input.Key6:         ebiten.KeyDigit6,
+	input.Key7:         ebiten.KeyDigit7,
+	input.Key8:         ebiten.KeyDigit8,
+	input.Key9:         ebiten.KeyDigit9,
+}
+
+// device is a part of the console that handles the program's Operations, like
+// gfx.Renderer. Every device is given every Operation, and ignores those of other devices.
+// Op returns the bytes that an Operation outputs to the program, if any, which are stored
+// below the opcode when the program is resumed.
+//
+// A device only touches the program's memory in Op for Operations whose opcode is Sync.
+// Devices that read or write it every frame, like the keyboard, do so in a method such as
+// Update that the host calls once per frame while the Program is locked.
+type device interface {
+	Op(op vm.Op) (out []byte)
+}
+
 type System struct {
-	program *vm.Program
-	opChan  chan vm.Op
+	program  *vm.Program
+	opChan   chan vm.Op
+	renderer *gfx.Renderer
+	keyboard *input.Keyboard
+	mouse    *input.Mouse
+	synth    *sound.Synth
+	music    *sound.Sequencer
+	devices  []device // Every device above, which handle the program's Operations.
+
+	player *audio.Player // Plays the audio of synth.
+
+	text *input.TextInput // The characters typed into the window, read by ','.
 
-	canvas *ebiten.Image
-	color  color.NRGBA
+	width, height int
+	canvas        *ebiten.Image
+	frame         *image.RGBA // The last composited frame from the renderer.
 
 	didInit bool
+	vsync   bool    // Whether the program is waiting for this frame after an OpPresent.
+	wheel   float64 // The wheel movement not yet reported to the program as whole steps.
 }
 
 func (s *System) init() {
@@ -35,50 +114,187 @@ func (s *System) Update() error {
 		s.didInit = true
 	}
 
-	limit := 60
+	var keys [input.KeyCount]byte
+	for key, ebitenKey := range keyMap {
+		if ebiten.IsKeyPressed(ebitenKey) {
+			keys[key] |= input.KeyHeld
+		}
+		if inpututil.IsKeyJustPressed(ebitenKey) {
+			keys[key] |= input.KeyPressed
+		}
+		if inpututil.IsKeyJustReleased(ebitenKey) {
+			keys[key] |= input.KeyReleased
+		}
+	}
+	mouse := s.mouseState()
+
+	chars := []byte(string(ebiten.AppendInputChars(nil)))
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter) {
+		chars = append(chars, '\n')
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
+		chars = append(chars, '\b')
+	}
+	s.text.Type(chars)
+
+	s.program.Lock()
+	s.keyboard.Update(keys)
+	s.mouse.Update(mouse)
+	s.program.Unlock()
+
+	if s.vsync {
+		s.vsync = false
+		s.program.Resume(nil)
+	}
+
 loop:
-	for range limit {
+	for range opsPerFrame {
 		select {
 		case op := <-s.opChan:
-			switch op.Code {
-			case vm.OpClearCanvas:
-				s.canvas.Clear()
-			case vm.OpSetColor:
-				s.color.R = op.Byte(3)
-				s.color.G = op.Byte(2)
-				s.color.B = op.Byte(1)
-				s.color.A = op.Byte(0)
-			case vm.OpSetPixel:
-				x := op.Byte(1)
-				y := op.Byte(0)
-				s.canvas.Set(int(x), int(y), s.color)
-			case vm.OpDrawLine:
-				x1 := float32(op.Byte(3))
-				y1 := float32(op.Byte(2))
-				x2 := float32(op.Byte(1))
-				y2 := float32(op.Byte(0))
-				vector.StrokeLine(s.canvas, x1, y1, x2, y2, 1, s.color, false)
+			if s.vsync = handleOp(s.devices, s.program, op); s.vsync {
+				break loop
 			}
 		default:
 			break loop
 		}
 	}
 
+	s.program.Lock()
+	s.frame = s.renderer.Frame()
+	s.music.Update()
+	s.program.Unlock()
+
 	return nil
 }
 
+// mouseState returns the state of the mouse for the mouse device. The cursor position from
+// ebiten is already in the canvas coordinates set by Layout, however the window is scaled.
+func (s *System) mouseState() input.MouseState {
+	x, y := ebiten.CursorPosition()
+	state := input.MouseState{
+		X: max(0, min(x, s.width-1)),
+		Y: max(0, min(y, s.height-1)),
+	}
+	if x == state.X && y == state.Y {
+		state.Held |= input.MouseOver
+	}
+
+	buttons := []struct {
+		button ebiten.MouseButton
+		bit    byte
+	}{
+		{ebiten.MouseButtonLeft, input.MouseLeft},
+		{ebiten.MouseButtonRight, input.MouseRight},
+		{ebiten.MouseButtonMiddle, input.MouseMiddle},
+	}
+	for _, b := range buttons {
+		if ebiten.IsMouseButtonPressed(b.button) {
+			state.Held |= b.bit
+		}
+		if inpututil.IsMouseButtonJustPressed(b.button) {
+			state.Pressed |= b.bit
+		}
+	}
+
+	// Touchpads report fractions of a step, which add up over several frames
+	_, wheel := ebiten.Wheel()
+	s.wheel += wheel
+	state.Wheel = int(s.wheel)
+	s.wheel -= float64(state.Wheel)
+	return state
+}
+
+// handleOp applies op to every device, and resumes program if it is waiting for op. The
+// exception is an OpPresent that waits for the next frame: handleOp reports it by returning
+// true, and program must then be resumed at the start of the next frame.
+func handleOp(devices []device, program *vm.Program, op vm.Op) (vsync bool) {
+	var out []byte
+	for _, d := range devices {
+		if o := d.Op(op); o != nil {
+			out = o
+		}
+	}
+	if op.Code == vm.OpPresent && op.Byte(0) != 0 {
+		return true
+	}
+	if op.Code.Sync() {
+		program.Resume(out)
+	}
+	return false
+}
+
 func (s *System) Draw(screen *ebiten.Image) {
-	// Graphics...
-	// ebitenutil.DebugPrint(screen, "test")
+	if s.frame == nil {
+		return // Nothing has been composited yet
+	}
+	s.canvas.WritePixels(s.frame.Pix)
 	screen.DrawImage(s.canvas, &ebiten.DrawImageOptions{})
 }
 
 func (s *System) Layout(_outsideWidth, _outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
+	return s.width, s.height
+}
+
+// parseSize parses a screen size given as "WxH", like "320x240".
+func parseSize(size string) (width, height int, err error) {
+	if _, err := fmt.Sscanf(size, "%dx%d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("invalid screen size %q: %w", size, err)
+	}
+	if width < 1 || height < 1 || width > maxScreenSize || height > maxScreenSize {
+		return 0, 0, fmt.Errorf("screen size %q is out of range", size)
+	}
+	return width, height, nil
+}
+
+// runClassic runs program in the classic dialect, with '.' and ',' on stdout and stdin.
+func runClassic(program *vm.Program) error {
+	out := bufio.NewWriter(os.Stdout)
+	program.Classic = true
+	program.Input = bufio.NewReader(promptReader{os.Stdin, out})
+	program.Output = out
+
+	err := program.Run(nil)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// promptReader reads from r, but first flushes w, so that the output of a program is shown
+// before it waits for input, such as a prompt.
+type promptReader struct {
+	r io.Reader
+	w *bufio.Writer
+}
+
+func (p promptReader) Read(b []byte) (n int, err error) {
+	if err := p.w.Flush(); err != nil {
+		return 0, err
+	}
+	return p.r.Read(b)
 }
 
 func main() {
-	bytes, err := os.ReadFile("boot.bf")
+	flagHeadless := flag.Bool("headless", false, "run without a window and save the final frame")
+	flagFrames := flag.Int("frames", 60, "number of frames to run in headless mode")
+	flagOutput := flag.String("o", "out.png", "output PNG file in headless mode")
+	flagWAV := flag.String("wav", "", "output WAV file of the audio in headless mode")
+	flagSize := flag.String("size", "", "screen size as WxH, overriding the cart's @size")
+	flagClassic := flag.Bool("classic", false, "run a classic Brainfuck program without a window, with '.' and ',' on stdout and stdin")
+
+	// "bf8 run [flags] cart" is the same as "bf8 [flags] cart"
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+
+	cartName := "boot.bf"
+	if flag.NArg() > 0 {
+		cartName = flag.Arg(0)
+	}
+
+	bytes, err := os.ReadFile(cartName)
 	if err != nil {
 		panic(err)
 	}
@@ -88,20 +304,82 @@ func main() {
 		panic(err)
 	}
 
+	if *flagClassic {
+		if err := runClassic(program); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// A classic cart run on the console prints its output to the text console
+	program.Classic = vm.Metadata(bytes)["dialect"] == "classic"
+
+	width, height := defaultWidth, defaultHeight
+	size := *flagSize
+	if size == "" {
+		size = vm.Metadata(bytes)["size"]
+	}
+	if size != "" {
+		width, height, err = parseSize(size)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if *flagHeadless {
+		if err := runHeadless(program, width, height, *flagFrames, *flagOutput, *flagWAV); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	// Brainfuck is only truly as fast as we can handle its Operations. Increasing the channel
 	// size helps to keep it from blocking, but also handling more operations per Update.
 
-	program.ClockRate = time.Millisecond // One brainfuck instruction every millisecond
+	program.ClockRate = clockRate // One brainfuck instruction every millisecond
+
+	text := input.NewTextInput()
+	text.Wait = program.Classic // Only classic carts wait for the user to type
+	program.Input = text
+
+	renderer := gfx.NewRenderer(width, height)
+	renderer.Memory = program.DataSection()
+	if program.Classic {
+		program.Output = renderer.ShowConsole(1, 0)
+	}
+
+	keyboard := &input.Keyboard{Memory: program.DataSection()}
+	mouse := &input.Mouse{Memory: program.DataSection()}
+
+	synth := sound.NewSynth()
+	synth.Memory = program.DataSection()
+	music := sound.NewSequencer(synth)
+	music.Memory = program.DataSection()
+	player, err := audio.NewContext(sound.SampleRate).NewPlayer(synth)
+	if err != nil {
+		panic(err)
+	}
+	player.SetBufferSize(100 * time.Millisecond) // Keep the latency of new notes low
+	player.Play()
 
 	system := &System{
-		program: program,
-		opChan:  make(chan vm.Op, 256), // Channels must be buffered to do non-blocking reads
+		program:  program,
+		opChan:   make(chan vm.Op, 256), // Channels must be buffered to do non-blocking reads
+		renderer: renderer,
+		keyboard: keyboard,
+		mouse:    mouse,
+		synth:    synth,
+		music:    music,
+		devices:  []device{renderer, keyboard, mouse, synth, music},
+		player:   player,
+		text:     text,
 
-		canvas: ebiten.NewImage(screenWidth, screenHeight),
-		color:  color.NRGBA{},
+		width:  width,
+		height: height,
+		canvas: ebiten.NewImage(width, height),
 	}
 
-	ebiten.SetWindowSize(screenWidth*3, screenHeight*3)
+	ebiten.SetWindowSize(width*3, height*3)
 	ebiten.SetWindowTitle("bf8")
 	if err := ebiten.RunGame(system); err != nil {
 		panic(err)
@@ -0,0 +1,172 @@
+package sound
+
+import "github.com/fivemoreminix/bf8/vm"
+
+// Special notes of a track event.
+const (
+	NoteRest = 0   // Releases the note of the channel.
+	NoteEnd  = 255 // Ends the track, or starts it over if the song loops.
+)
+
+// DefaultTempo is the number of frames per tick of a Sequencer until OpSetTempo.
+const DefaultTempo = 6
+
+// instrumentSize is the number of bytes of an instrument in a song.
+const instrumentSize = 7
+
+// maxEvents is the most events that a track may start in one tick, so that a looping track
+// of events without a duration cannot hang the host.
+const maxEvents = 64
+
+// track is the playback state of a track of the song.
+type track struct {
+	addr      int // The start of the track, or -1 if the channel is not part of the song.
+	position  int // The address of the next event.
+	remaining int // The ticks until the next event.
+}
+
+// Sequencer is the music device, which plays a song from a program's memory on the
+// channels of a Synth, in sync with the frames of the host.
+//
+// A song begins with the 2 byte addresses of the tracks of the Channels channels, where 0
+// leaves a channel out of the song, followed by the 2 byte address of its instruments.
+// A track is a list of 3 byte events: a note, its duration in ticks and its instrument.
+// Notes are numbered in semitones like MIDI, so that 69 is A4 at 440 Hz, besides NoteRest
+// and NoteEnd. An instrument is 7 bytes: the waveform, volume, duty, attack, decay,
+// sustain and release of the channel, as for the sound opcodes.
+type Sequencer struct {
+	// Memory is the data section of the program, which the song is read from. It is only
+	// accessed while handling OpPlayMusic, whose opcode is Sync, and by Update.
+	Memory []byte
+	Synth  *Synth
+
+	playing bool
+	loop    bool
+	song    int
+	tempo   int // Frames per tick.
+	frame   int // Frames since the last tick.
+	tracks  [Channels]track
+}
+
+func NewSequencer(synth *Synth) *Sequencer {
+	return &Sequencer{Synth: synth, tempo: DefaultTempo}
+}
+
+// Op applies an operation to the sequencer and returns the bytes that it outputs to the
+// program, if any. Operations that are not for the sequencer are ignored.
+func (q *Sequencer) Op(op vm.Op) (out []byte) {
+	switch op.Code {
+	case vm.OpPlayMusic:
+		q.stop()
+		q.playing = true
+		q.song = int(op.Word(1))
+		q.loop = op.Byte(0) != 0
+		q.frame = q.tempo - 1 // The first tick is on the next frame
+		for i := range q.tracks {
+			addr := int(q.word(q.song + i*2))
+			if addr == 0 {
+				addr = -1
+			}
+			q.tracks[i] = track{addr: addr, position: addr}
+		}
+	case vm.OpStopMusic:
+		q.stop()
+	case vm.OpSetTempo:
+		q.tempo = max(1, int(op.Byte(0)))
+	}
+	return nil
+}
+
+// Update advances the song by a frame. The host calls Update once per frame while the
+// Program is locked.
+func (q *Sequencer) Update() {
+	if !q.playing {
+		return
+	}
+	q.frame++
+	if q.frame < q.tempo {
+		return
+	}
+	q.frame = 0
+
+	playing := false
+	for i := range q.tracks {
+		t := &q.tracks[i]
+		if t.addr < 0 {
+			continue
+		}
+		if t.remaining > 0 {
+			t.remaining--
+		}
+		for n := 0; t.remaining == 0 && t.addr >= 0 && n < maxEvents; n++ {
+			q.event(i, t)
+		}
+		playing = playing || t.addr >= 0
+	}
+	q.playing = playing
+}
+
+// event starts the next event of track t on channel i.
+func (q *Sequencer) event(i int, t *track) {
+	note, duration, instrument := q.byte(t.position), q.byte(t.position+1), q.byte(t.position+2)
+	switch note {
+	case NoteEnd:
+		if q.loop {
+			t.position = t.addr
+		} else {
+			q.Synth.release(i)
+			t.addr = -1
+		}
+		return
+	case NoteRest:
+		q.Synth.release(i)
+	default:
+		instruments := int(q.word(q.song + Channels*2))
+		var inst [instrumentSize]byte
+		for j := range inst {
+			inst[j] = q.byte(instruments + int(instrument)*instrumentSize + j)
+		}
+		q.Synth.play(i, noteFrequency(note), inst)
+	}
+	t.position += 3
+	t.remaining = int(duration)
+}
+
+// stop stops the song and releases the notes of its channels.
+func (q *Sequencer) stop() {
+	if !q.playing {
+		return
+	}
+	q.playing = false
+	for i, t := range q.tracks {
+		if t.addr >= 0 {
+			q.Synth.release(i)
+		}
+	}
+}
+
+// byte returns Memory[addr], or 0 if addr is past its end.
+func (q *Sequencer) byte(addr int) byte {
+	if addr >= len(q.Memory) {
+		return 0
+	}
+	return q.Memory[addr]
+}
+
+// word returns the big-endian word at Memory[addr], with bytes past its end read as 0.
+func (q *Sequencer) word(addr int) uint16 {
+	return uint16(q.byte(addr))<<8 | uint16(q.byte(addr+1))
+}
+
+// octave8 holds the frequencies in Hz of the notes of the eighth octave, from C8 (note 108)
+// to B8 (note 119).
+var octave8 = [12]int{4186, 4435, 4699, 4978, 5274, 5588, 5920, 6272, 6645, 7040, 7459, 7902}
+
+// noteFrequency returns the frequency in Hz of a note, numbered like MIDI.
+func noteFrequency(note byte) int {
+	shift := 9 - int(note)/12
+	if shift < 0 {
+		return octave8[note%12] << -shift
+	}
+	return octave8[note%12] >> shift
+}
@@ -0,0 +1,127 @@
+package sound
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+func TestNoteFrequency(t *testing.T) {
+	table := []struct {
+		note byte
+		want int
+	}{
+		{69, 440},   // A4
+		{57, 220},   // A3
+		{60, 261},   // C4
+		{108, 4186}, // C8
+		{127, 12544},
+	}
+	for _, test := range table {
+		if got := noteFrequency(test.note); got != test.want {
+			t.Errorf("noteFrequency(%d) = %d, want %d", test.note, got, test.want)
+		}
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	memory := []byte{
+		// Song: channel 0 plays the track at 10, with the instruments at 20
+		0, 10, 0, 0, 0, 0, 0, 0, 0, 20,
+		// Track: A4 for 2 ticks, a rest for 1 tick, C4 for 1 tick with instrument 1, the end
+		69, 2, 0, NoteRest, 1, 0, 60, 1, 1, NoteEnd,
+		// Instruments: a square wave and a triangle wave
+		WaveSquare, 255, 128, 0, 0, 255, 0,
+		WaveTriangle, 100, 128, 0, 0, 255, 0,
+	}
+	synth := NewSynth()
+	q := NewSequencer(synth)
+	q.Memory = memory
+	q.Op(vm.NewOp(vm.OpSetTempo, 1))
+	q.Op(vm.NewOp(vm.OpPlayMusic, 0, 0, 0))
+
+	c := &synth.channels[0]
+	table := []struct {
+		frequency int
+		waveform  byte
+		stage     int
+	}{
+		{440, WaveSquare, stageAttack},
+		{440, WaveSquare, stageAttack},
+		{440, WaveSquare, stageRelease},
+		{261, WaveTriangle, stageAttack},
+		{261, WaveTriangle, stageRelease}, // The end of the song
+	}
+	for tick, want := range table {
+		q.Update()
+		if c.frequency != want.frequency || c.waveform != want.waveform || c.stage != want.stage {
+			t.Errorf("tick %d: frequency %d, waveform %d, stage %d; want %d, %d, %d", tick,
+				c.frequency, c.waveform, c.stage, want.frequency, want.waveform, want.stage)
+		}
+	}
+	if q.playing {
+		t.Error("the song is still playing after its end")
+	}
+
+	// A looping song starts over, until it is stopped
+	q.Op(vm.NewOp(vm.OpPlayMusic, 0, 0, 1))
+	for range 5 {
+		q.Update()
+	}
+	if c.frequency != 440 || c.stage != stageAttack || !q.playing {
+		t.Errorf("frequency %d, stage %d after looping; want 440, %d", c.frequency, c.stage, stageAttack)
+	}
+	q.Op(vm.NewOp(vm.OpStopMusic))
+	if c.stage != stageRelease {
+		t.Errorf("stage %d after OpStopMusic, want %d", c.stage, stageRelease)
+	}
+
+	// A looping track without durations does not hang
+	memory[10], memory[11], memory[12] = 69, 0, 0
+	memory[13] = NoteEnd
+	q.Op(vm.NewOp(vm.OpPlayMusic, 0, 0, 1))
+	q.Update()
+}
+
+func TestSequencerProgram(t *testing.T) {
+	// The song of TestSequencer, with its track at 32 and its instruments at 48
+	song := map[int]byte{
+		1: 16, 2: 1, // OpPlayMusic arguments: the song at 16, looping
+		17: 32, 25: 48, 32: 69, 33: 1, 35: NoteEnd, 49: 255, 50: 128, 53: 255,
+	}
+	var code strings.Builder
+	cell := 0
+	for i := range 64 {
+		if song[i] != 0 {
+			code.WriteString(strings.Repeat(">", i-cell) + strings.Repeat("+", int(song[i])))
+			cell = i
+		}
+	}
+	// Call OpPlayMusic, then remove the song's track and keep changing memory forever
+	code.WriteString(strings.Repeat("<", cell-3) + strings.Repeat("+", int(vm.OpPlayMusic)) + ".")
+	code.WriteString(strings.Repeat(">", 17-3) + "[-]+[>+<]")
+
+	p, err := vm.NewProgram([]byte(code.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synth := NewSynth()
+	q := NewSequencer(synth)
+	q.Memory = p.DataSection()
+
+	opChan := make(chan vm.Op)
+	go p.Run(opChan)
+	op := <-opChan
+	q.Op(op)
+	if op.Code.Sync() {
+		p.Resume(nil)
+	}
+
+	p.Lock()
+	q.Update()
+	p.Unlock()
+	if c := &synth.channels[0]; c.frequency != 440 || c.stage != stageAttack {
+		t.Errorf("frequency %d, stage %d; want 440, %d", c.frequency, c.stage, stageAttack)
+	}
+}
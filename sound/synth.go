@@ -0,0 +1,308 @@
+package sound
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+const (
+	SampleRate   = 44100           // Samples per second of the audio from a Synth.
+	FrameSamples = SampleRate / 60 // Samples per frame of the host, the unit of envelope times.
+	Channels     = 4               // The number of channels of a Synth.
+	Voices       = 2               // The number of sample voices of a Synth.
+)
+
+// Waveforms of a channel.
+const (
+	WaveSquare   = 0 // A square wave, high for a duty cycle of the period.
+	WaveTriangle = 1
+	WaveNoise    = 2 // Pseudo-random noise, changing frequency times a second.
+)
+
+// sources is the number of channels and voices that a Synth mixes. The mix is divided by
+// it, so that it does not clip even when every one of them plays at full volume.
+const sources = Channels + Voices
+
+// maxLevel is the envelope level of a channel at full volume. Levels are volumes scaled by
+// 1<<16, so that envelopes can change them by less than one per sample.
+const maxLevel = 255 << 16
+
+// Stages of the envelope of a channel.
+const (
+	stageOff = iota
+	stageAttack
+	stageDecay
+	stageSustain
+	stageRelease
+)
+
+// channel is a tone generator of a Synth.
+type channel struct {
+	waveform  byte
+	frequency int  // In Hz.
+	volume    byte // Scales the envelope.
+	duty      byte // The 256ths of the period that a square wave is high.
+
+	// The envelope: attack, decay and release are times in frames, and sustain is the
+	// level that the note holds between the decay and the release.
+	attack, decay, sustain, release byte
+
+	phase uint32 // The position within the period, where 1<<32 is a whole period.
+	noise uint16 // The state of the noise generator, a 15-bit LFSR that is never 0.
+	stage int
+	level int // The current envelope level, from 0 to maxLevel.
+}
+
+// voice plays a recorded sample for a Synth.
+type voice struct {
+	data     []byte // 8-bit unsigned PCM, or nil when the voice is silent.
+	step     int    // The samples of data per sample of output, scaled by 1<<16.
+	position int    // The position within data, scaled by 1<<16.
+	loop     bool
+}
+
+// Synth is the sound device, a synthesizer of Channels channels. Each channel plays one
+// waveform at a time at its frequency, with a volume that follows an envelope: a note
+// rises to full volume over the attack, falls to the sustain level over the decay, holds
+// it until the note is off and falls to silence over the release. Along with the channels,
+// each of Voices voices can play a sample recorded in memory.
+//
+// A Synth is an io.Reader of its audio output, as 16-bit signed little-endian stereo
+// samples at SampleRate. Only integer math is used, so the output is the same on every
+// machine. It is safe to read the audio while another goroutine handles Operations.
+type Synth struct {
+	// Memory is the data section of the program, which OpPlaySample reads from. It is only
+	// accessed while handling an Op whose opcode is Sync.
+	Memory []byte
+
+	mu       sync.Mutex
+	channels [Channels]channel
+	voices   [Voices]voice
+}
+
+func NewSynth() *Synth {
+	s := &Synth{}
+	for i := range s.channels {
+		s.channels[i] = channel{volume: 255, duty: 128, sustain: 255, noise: 1}
+	}
+	// Like the classic consoles: two square waves, a triangle wave and noise
+	s.channels[2].waveform = WaveTriangle
+	s.channels[3].waveform = WaveNoise
+	return s
+}
+
+// Op applies an operation to the synthesizer and returns the bytes that it outputs to
+// the program, if any. Operations that are not for the synthesizer are ignored, as are
+// those for channels that do not exist.
+func (s *Synth) Op(op vm.Op) (out []byte) {
+	switch op.Code {
+	case vm.OpPlaySample, vm.OpStopSample:
+		s.sampleOp(op)
+		return nil
+	}
+
+	var n int
+	switch op.Code {
+	case vm.OpSetFrequency:
+		n = 2
+	case vm.OpSetVolume, vm.OpSetDuty, vm.OpSetWaveform:
+		n = 1
+	case vm.OpSetEnvelope:
+		n = 4
+	case vm.OpNoteOn, vm.OpNoteOff:
+		n = 0
+	default:
+		return nil
+	}
+	// The channel is the first argument, before the n others
+	i := int(op.Byte(n))
+	if i >= Channels {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &s.channels[i]
+	switch op.Code {
+	case vm.OpSetFrequency:
+		c.frequency = min(int(op.Word(0)), SampleRate/2) // Higher frequencies would alias
+	case vm.OpSetVolume:
+		c.volume = op.Byte(0)
+	case vm.OpSetDuty:
+		c.duty = op.Byte(0)
+	case vm.OpSetWaveform:
+		c.waveform = op.Byte(0)
+	case vm.OpSetEnvelope:
+		c.attack, c.decay, c.sustain, c.release = op.Byte(3), op.Byte(2), op.Byte(1), op.Byte(0)
+	case vm.OpNoteOn:
+		c.stage = stageAttack
+		c.phase = 0
+	case vm.OpNoteOff:
+		if c.stage != stageOff {
+			c.stage = stageRelease
+		}
+	}
+	return nil
+}
+
+// play starts a note of the given frequency on channel i, with the settings of an
+// instrument: waveform, volume, duty, attack, decay, sustain and release.
+func (s *Synth) play(i, frequency int, instrument [7]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &s.channels[i]
+	c.waveform, c.volume, c.duty = instrument[0], instrument[1], instrument[2]
+	c.attack, c.decay, c.sustain, c.release = instrument[3], instrument[4], instrument[5], instrument[6]
+	c.frequency = min(frequency, SampleRate/2)
+	c.stage = stageAttack
+	c.phase = 0
+}
+
+// release starts the release of the note on channel i, like OpNoteOff.
+func (s *Synth) release(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := &s.channels[i]; c.stage != stageOff {
+		c.stage = stageRelease
+	}
+}
+
+// sampleOp applies an operation on a sample voice.
+func (s *Synth) sampleOp(op vm.Op) {
+	if op.Code == vm.OpStopSample {
+		if i := int(op.Byte(0)); i < Voices {
+			s.mu.Lock()
+			s.voices[i] = voice{}
+			s.mu.Unlock()
+		}
+		return
+	}
+
+	i := int(op.Byte(7))
+	if i >= Voices {
+		return
+	}
+	// The sample is copied, so that the program may change its memory while it plays
+	addr, length := int(op.Word(5)), int(op.Word(3))
+	var data []byte
+	if addr < len(s.Memory) {
+		data = bytes.Clone(s.Memory[addr:min(addr+length, len(s.Memory))])
+	}
+	v := voice{
+		data: data,
+		step: int(op.Word(1)) << 16 / SampleRate,
+		loop: op.Byte(0) != 0,
+	}
+
+	s.mu.Lock()
+	s.voices[i] = v
+	s.mu.Unlock()
+}
+
+// Read fills p with as many whole stereo samples as fit.
+func (s *Synth) Read(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n = 0; n+4 <= len(p); n += 4 {
+		mix := 0
+		for i := range s.channels {
+			mix += s.channels[i].sample()
+		}
+		for i := range s.voices {
+			mix += s.voices[i].sample()
+		}
+		v := int16(max(-32768, min(mix/sources, 32767)))
+		p[n], p[n+1] = byte(v), byte(v>>8)   // Left
+		p[n+2], p[n+3] = byte(v), byte(v>>8) // Right
+	}
+	return n, nil
+}
+
+// sample returns the next sample of the channel, from -32767 to 32767, and advances it.
+func (c *channel) sample() int {
+	c.envelope()
+	if c.stage == stageOff || c.frequency == 0 {
+		return 0
+	}
+
+	var wave int
+	switch c.waveform {
+	case WaveSquare:
+		wave = -32767
+		if byte(c.phase>>24) < c.duty {
+			wave = 32767
+		}
+	case WaveTriangle:
+		t := int(c.phase >> 16) // 0 to 65535 over the period
+		if t < 32768 {
+			wave = -32767 + t*2
+		} else {
+			wave = 32767 - (t-32768)*2
+		}
+	case WaveNoise:
+		wave = -32767
+		if c.noise&1 != 0 {
+			wave = 32767
+		}
+	}
+
+	step := uint32(uint64(c.frequency) << 32 / SampleRate)
+	if c.phase+step < c.phase && c.waveform == WaveNoise {
+		// A new period; step the noise generator
+		bit := (c.noise ^ c.noise>>1) & 1
+		c.noise = c.noise>>1 | bit<<14
+	}
+	c.phase += step
+
+	return wave * int(c.volume) / 255 * (c.level >> 16) / 255
+}
+
+// sample returns the next sample of the voice, from -32768 to 32512, and advances it.
+func (v *voice) sample() int {
+	i := v.position >> 16
+	if i >= len(v.data) {
+		if !v.loop || len(v.data) == 0 {
+			v.data = nil
+			return 0
+		}
+		v.position %= len(v.data) << 16
+		i = v.position >> 16
+	}
+	v.position += v.step
+	return (int(v.data[i]) - 128) << 8
+}
+
+// envelope advances the envelope of the channel by a sample.
+func (c *channel) envelope() {
+	// rate returns the change in level per sample to cover the whole range in frames.
+	rate := func(frames byte) int {
+		return maxLevel / (int(frames) * FrameSamples)
+	}
+	sustain := int(c.sustain) << 16
+
+	switch c.stage {
+	case stageAttack:
+		if c.attack == 0 || c.level+rate(c.attack) >= maxLevel {
+			c.level, c.stage = maxLevel, stageDecay
+		} else {
+			c.level += rate(c.attack)
+		}
+	case stageDecay:
+		if c.decay == 0 || c.level-rate(c.decay) <= sustain {
+			c.level, c.stage = sustain, stageSustain
+		} else {
+			c.level -= rate(c.decay)
+		}
+	case stageSustain:
+		c.level = sustain
+	case stageRelease:
+		if c.release == 0 || c.level-rate(c.release) <= 0 {
+			c.level, c.stage = 0, stageOff
+		} else {
+			c.level -= rate(c.release)
+		}
+	}
+}
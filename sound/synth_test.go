@@ -0,0 +1,166 @@
+package sound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/fivemoreminix/bf8/vm"
+)
+
+// samples reads n samples of the left channel from s.
+func samples(s *Synth, n int) []int16 {
+	buf := make([]byte, n*4)
+	s.Read(buf)
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(binary.LittleEndian.Uint16(buf[i*4:]))
+	}
+	return out
+}
+
+func TestSynthSquare(t *testing.T) {
+	s := NewSynth()
+	s.Op(vm.NewOp(vm.OpSetFrequency, 0, 0x01, 0xB9)) // 441 Hz, a period of 100 samples
+	s.Op(vm.NewOp(vm.OpSetDuty, 0, 64))              // High for a quarter of the period
+	for _, v := range samples(s, 10) {
+		if v != 0 {
+			t.Fatal("a channel played before OpNoteOn")
+		}
+	}
+
+	s.Op(vm.NewOp(vm.OpNoteOn, 0))
+	high, low := 0, 0
+	for _, v := range samples(s, 100) {
+		switch v {
+		case 32767 / sources:
+			high++
+		case -32767 / sources:
+			low++
+		default:
+			t.Fatalf("sample %d of a square wave is neither high nor low", v)
+		}
+	}
+	// The phase step is rounded down, so the high part may last a sample longer
+	if high != 25 && high != 26 {
+		t.Errorf("%d high and %d low samples in a period, want about 25 and 75", high, low)
+	}
+
+	s.Op(vm.NewOp(vm.OpNoteOff, 0))
+	for _, v := range samples(s, 10) {
+		if v != 0 {
+			t.Fatal("a channel played after OpNoteOff without a release")
+		}
+	}
+}
+
+func TestSynthEnvelope(t *testing.T) {
+	s := NewSynth()
+	s.Op(vm.NewOp(vm.OpSetFrequency, 0, 0x01, 0xB9))
+	s.Op(vm.NewOp(vm.OpSetDuty, 0, 255))              // Nearly always high, to measure the volume
+	s.Op(vm.NewOp(vm.OpSetEnvelope, 0, 2, 0, 128, 1)) // A 2 frame attack, then half volume
+	s.Op(vm.NewOp(vm.OpNoteOn, 0))
+
+	attack := samples(s, 2*FrameSamples)
+	if first, last := attack[0], attack[len(attack)-1]; first >= last || last < 32767/sources-300 {
+		t.Errorf("the attack went from %d to %d, want a rise to full volume", first, last)
+	}
+	if v := samples(s, 10)[9]; v != 32767*128/255/sources {
+		t.Errorf("sustained sample = %d, want %d", v, 32767*128/255/sources)
+	}
+
+	s.Op(vm.NewOp(vm.OpNoteOff, 0))
+	release := samples(s, FrameSamples+1)
+	if release[0] == 0 || release[FrameSamples] != 0 {
+		t.Errorf("the release went from %d to %d, want a fall to silence over a frame", release[0], release[FrameSamples])
+	}
+}
+
+func TestSynthDeterministic(t *testing.T) {
+	// Every waveform, on every channel, produces the same audio every time
+	render := func() []byte {
+		s := NewSynth()
+		for i := range byte(Channels) {
+			s.Op(vm.NewOp(vm.OpSetFrequency, i, 0x03, 0x70-i))
+			s.Op(vm.NewOp(vm.OpNoteOn, i))
+		}
+		buf := make([]byte, FrameSamples*4)
+		s.Read(buf)
+		return buf
+	}
+	first := render()
+	if !bytes.Equal(first, render()) {
+		t.Error("two Synths produced different audio")
+	}
+	if bytes.Equal(first, make([]byte, len(first))) {
+		t.Error("the Synth produced silence")
+	}
+}
+
+func TestSynthMix(t *testing.T) {
+	s := NewSynth()
+	s.Memory = []byte{255}
+	for i := range byte(Channels) {
+		s.Op(vm.NewOp(vm.OpSetWaveform, i, WaveSquare))
+		s.Op(vm.NewOp(vm.OpSetFrequency, i, 0x01, 0xB9))
+		s.Op(vm.NewOp(vm.OpSetDuty, i, 255)) // Nearly always high
+		s.Op(vm.NewOp(vm.OpNoteOn, i))
+	}
+	for i := range byte(Voices) {
+		s.Op(vm.NewOp(vm.OpPlaySample, i, 0, 0, 0, 1, byte(SampleRate>>8), byte(SampleRate&0xFF), 1))
+	}
+
+	// Every source plays at full volume, and the mix stays below the largest sample
+	want := int16((Channels*32767 + Voices*(127<<8)) / sources)
+	if got := samples(s, 1)[0]; got != want {
+		t.Errorf("mixed sample = %d, want %d", got, want)
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	var buf bytes.Buffer
+	pcm := []byte{1, 2, 3, 4}
+	if err := WriteWAV(&buf, pcm); err != nil {
+		t.Fatal(err)
+	}
+	wav := buf.Bytes()
+	if len(wav) != 44+len(pcm) {
+		t.Fatalf("len = %d, want %d", len(wav), 44+len(pcm))
+	}
+	if string(wav[:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Errorf("bad header %q", wav[:44])
+	}
+	if got := binary.LittleEndian.Uint32(wav[24:]); got != SampleRate {
+		t.Errorf("sample rate = %d, want %d", got, SampleRate)
+	}
+	if !bytes.Equal(wav[44:], pcm) {
+		t.Errorf("data = %v, want %v", wav[44:], pcm)
+	}
+}
+
+func TestSynthSample(t *testing.T) {
+	s := NewSynth()
+	s.Memory = []byte{0, 128, 255, 0}
+	// Play the 3 samples at Memory[1:] at half the output rate
+	rate := SampleRate / 2
+	s.Op(vm.NewOp(vm.OpPlaySample, 1, 0, 1, 0, 3, byte(rate>>8), byte(rate), 0))
+	s.Memory[2] = 0 // The sample was copied
+
+	want := []int16{0, 0, 127 << 8 / sources, 127 << 8 / sources, -128 << 8 / sources, -128 << 8 / sources, 0, 0}
+	if got := samples(s, len(want)); !slices.Equal(got, want) {
+		t.Errorf("samples = %v, want %v", got, want)
+	}
+
+	// A looping sample starts over at its end, until it is stopped
+	s.Memory[2] = 255
+	s.Op(vm.NewOp(vm.OpPlaySample, 0, 0, 2, 0, 2, byte(SampleRate>>8), byte(SampleRate&0xFF), 1))
+	want = []int16{127 << 8 / sources, -128 << 8 / sources, 127 << 8 / sources, -128 << 8 / sources}
+	if got := samples(s, len(want)); !slices.Equal(got, want) {
+		t.Errorf("looped samples = %v, want %v", got, want)
+	}
+	s.Op(vm.NewOp(vm.OpStopSample, 0))
+	if got := samples(s, 1); got[0] != 0 {
+		t.Errorf("sample after OpStopSample = %d, want 0", got[0])
+	}
+}
@@ -0,0 +1,44 @@
+package sound
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WriteWAV writes pcm, audio in the format read from a Synth, to w as a WAV file.
+func WriteWAV(w io.Writer, pcm []byte) error {
+	const channels, bytesPerSample = 2, 2
+	header := struct {
+		RIFF          [4]byte
+		Size          uint32
+		WAVE, Fmt     [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		Size:          uint32(36 + len(pcm)),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1, // PCM
+		Channels:      channels,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate * channels * bytesPerSample,
+		BlockAlign:    channels * bytesPerSample,
+		BitsPerSample: bytesPerSample * 8,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(len(pcm)),
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	_, err := w.Write(pcm)
+	return err
+}
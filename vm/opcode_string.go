@@ -27,18 +27,87 @@ func _() {
 	_ = x[OpSetColor-41]
 	_ = x[OpSetPixel-42]
 	_ = x[OpDrawLine-43]
+	_ = x[OpDrawRect-44]
+	_ = x[OpFillRect-45]
+	_ = x[OpDrawEllipse-46]
+	_ = x[OpFillEllipse-47]
+	_ = x[OpFillTriangle-48]
+	_ = x[OpDrawChar-49]
+	_ = x[OpDrawText-50]
+	_ = x[OpBlit-51]
+	_ = x[OpSetPalette-52]
+	_ = x[OpSetColorIndex-53]
+	_ = x[OpSetIndexedMode-54]
+	_ = x[OpSetFramebuffer-55]
+	_ = x[OpSetTilemap-56]
+	_ = x[OpSetScroll-57]
+	_ = x[OpSetSpriteTable-58]
+	_ = x[OpFloodFill-59]
+	_ = x[OpGetPixel-60]
+	_ = x[OpGetCanvasSize-61]
+	_ = x[OpSetClip-62]
+	_ = x[OpSetCamera-63]
+	_ = x[OpNewSurface-64]
+	_ = x[OpFreeSurface-65]
+	_ = x[OpSetTarget-66]
+	_ = x[OpCopyRect-67]
+	_ = x[OpPresent-68]
+	_ = x[OpSetBlendMode-69]
+	_ = x[OpSetConsole-70]
+	_ = x[OpPrintChar-71]
+	_ = x[OpPrintText-72]
+	_ = x[OpSetCursor-73]
+	_ = x[OpFillPolygon-80]
+	_ = x[OpBlitTransformed-81]
+	_ = x[OpSetPixel16-100]
+	_ = x[OpDrawLine16-101]
+	_ = x[OpDrawRect16-102]
+	_ = x[OpFillRect16-103]
+	_ = x[OpDrawEllipse16-104]
+	_ = x[OpFillEllipse16-105]
+	_ = x[OpFillTriangle16-106]
+	_ = x[OpDrawChar16-107]
+	_ = x[OpDrawText16-108]
+	_ = x[OpBlit16-109]
+	_ = x[OpFloodFill16-110]
+	_ = x[OpFillPolygon16-111]
+	_ = x[OpSetClip16-112]
+	_ = x[OpGetPixel16-113]
+	_ = x[OpSetSpriteTable16-114]
+	_ = x[OpSetKeyboard-120]
+	_ = x[OpSetMouse-121]
+	_ = x[OpSetFrequency-140]
+	_ = x[OpSetVolume-141]
+	_ = x[OpSetDuty-142]
+	_ = x[OpSetWaveform-143]
+	_ = x[OpSetEnvelope-144]
+	_ = x[OpNoteOn-145]
+	_ = x[OpNoteOff-146]
+	_ = x[OpPlaySample-147]
+	_ = x[OpStopSample-148]
+	_ = x[OpPlayMusic-149]
+	_ = x[OpStopMusic-150]
+	_ = x[OpSetTempo-151]
 }
 
 const (
 	_Opcode_name_0 = "OpNopOpRelJmpFwdOpRelJmpBwd"
 	_Opcode_name_1 = "OpR8AStoreOpR8BStoreOpR16AStoreOpR16BStoreOpR32AStoreOpR32BStoreOpR8ALoadOpR8BLoadOpR16ALoadOpR16BLoadOpR32ALoadOpR32BLoad"
-	_Opcode_name_2 = "OpClearCanvasOpSetColorOpSetPixelOpDrawLine"
+	_Opcode_name_2 = "OpClearCanvasOpSetColorOpSetPixelOpDrawLineOpDrawRectOpFillRectOpDrawEllipseOpFillEllipseOpFillTriangleOpDrawCharOpDrawTextOpBlitOpSetPaletteOpSetColorIndexOpSetIndexedModeOpSetFramebufferOpSetTilemapOpSetScrollOpSetSpriteTableOpFloodFillOpGetPixelOpGetCanvasSizeOpSetClipOpSetCameraOpNewSurfaceOpFreeSurfaceOpSetTargetOpCopyRectOpPresentOpSetBlendModeOpSetConsoleOpPrintCharOpPrintTextOpSetCursor"
+	_Opcode_name_3 = "OpFillPolygonOpBlitTransformed"
+	_Opcode_name_4 = "OpSetPixel16OpDrawLine16OpDrawRect16OpFillRect16OpDrawEllipse16OpFillEllipse16OpFillTriangle16OpDrawChar16OpDrawText16OpBlit16OpFloodFill16OpFillPolygon16OpSetClip16OpGetPixel16OpSetSpriteTable16"
+	_Opcode_name_5 = "OpSetKeyboardOpSetMouse"
+	_Opcode_name_6 = "OpSetFrequencyOpSetVolumeOpSetDutyOpSetWaveformOpSetEnvelopeOpNoteOnOpNoteOffOpPlaySampleOpStopSampleOpPlayMusicOpStopMusicOpSetTempo"
 )
 
 var (
 	_Opcode_index_0 = [...]uint8{0, 5, 16, 27}
 	_Opcode_index_1 = [...]uint8{0, 10, 20, 31, 42, 53, 64, 73, 82, 92, 102, 112, 122}
-	_Opcode_index_2 = [...]uint8{0, 13, 23, 33, 43}
+	_Opcode_index_2 = [...]uint16{0, 13, 23, 33, 43, 53, 63, 76, 89, 103, 113, 123, 129, 141, 156, 172, 188, 200, 211, 227, 238, 248, 263, 272, 283, 295, 308, 319, 329, 338, 352, 364, 375, 386, 397}
+	_Opcode_index_3 = [...]uint8{0, 13, 30}
+	_Opcode_index_4 = [...]uint8{0, 12, 24, 36, 48, 63, 78, 94, 106, 118, 126, 139, 154, 165, 177, 195}
+	_Opcode_index_5 = [...]uint8{0, 13, 23}
+	_Opcode_index_6 = [...]uint8{0, 14, 25, 34, 47, 60, 68, 77, 89, 101, 112, 123, 133}
 )
 
 func (i Opcode) String() string {
@@ -48,9 +117,21 @@ func (i Opcode) String() string {
 	case 20 <= i && i <= 31:
 		i -= 20
 		return _Opcode_name_1[_Opcode_index_1[i]:_Opcode_index_1[i+1]]
-	case 40 <= i && i <= 43:
+	case 40 <= i && i <= 73:
 		i -= 40
 		return _Opcode_name_2[_Opcode_index_2[i]:_Opcode_index_2[i+1]]
+	case 80 <= i && i <= 81:
+		i -= 80
+		return _Opcode_name_3[_Opcode_index_3[i]:_Opcode_index_3[i+1]]
+	case 100 <= i && i <= 114:
+		i -= 100
+		return _Opcode_name_4[_Opcode_index_4[i]:_Opcode_index_4[i+1]]
+	case 120 <= i && i <= 121:
+		i -= 120
+		return _Opcode_name_5[_Opcode_index_5[i]:_Opcode_index_5[i+1]]
+	case 140 <= i && i <= 151:
+		i -= 140
+		return _Opcode_name_6[_Opcode_index_6[i]:_Opcode_index_6[i+1]]
 	default:
 		return "Opcode(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 )
 
@@ -35,15 +37,135 @@ const (
 
 // 40 - 59 Graphics Drawing
 const (
-	OpClearCanvas Opcode = 40 + iota
-	OpSetColor           // 4 byte IN; r, g, b, a (non-alpha-premultiplied color)
-	OpSetPixel           // 2 byte IN; x, y
-	OpDrawLine           // 4 byte IN; x1, y1, x2, y2
+	OpClearCanvas    Opcode = 40 + iota
+	OpSetColor              // 4 byte IN; r, g, b, a (non-alpha-premultiplied color)
+	OpSetPixel              // 2 byte IN; x, y
+	OpDrawLine              // 4 byte IN; x1, y1, x2, y2
+	OpDrawRect              // 4 byte IN; x1, y1, x2, y2 (opposite corners, inclusive)
+	OpFillRect              // 4 byte IN; x1, y1, x2, y2 (opposite corners, inclusive)
+	OpDrawEllipse           // 4 byte IN; x, y, rx, ry (center and radii; rx = ry for a circle)
+	OpFillEllipse           // 4 byte IN; x, y, rx, ry (center and radii; rx = ry for a circle)
+	OpFillTriangle          // 6 byte IN; x1, y1, x2, y2, x3, y3
+	OpDrawChar              // 3 byte IN; char, x, y (8x8 built-in font)
+	OpDrawText              // 4 byte IN; addr (2 byte), x, y (NUL-terminated string at DataSection()[addr])
+	OpBlit                  // 8 byte IN; addr (2 byte), x, y, w, h, flags, key (sprite at DataSection()[addr])
+	OpSetPalette            // 5 byte IN; index, r, g, b, a (non-alpha-premultiplied color)
+	OpSetColorIndex         // 1 byte IN; index (current color = palette[index])
+	OpSetIndexedMode        // 1 byte IN; enabled (canvas stores palette indices when non-zero)
+	OpSetFramebuffer        // 3 byte IN; addr (2 byte), mode (0 = off, 1 = 1-bit, 2 = 2-bit, 3 = 8-bit)
+	OpSetTilemap            // 7 byte IN; map addr (2 byte), w, h (in tiles, so up to 2040 pixels), tiles addr (2 byte), mode (as OpSetFramebuffer)
+	OpSetScroll             // 4 byte IN; x (2 byte), y (2 byte) (tilemap scroll offset)
+	OpSetSpriteTable        // 5 byte IN; table addr (2 byte), tiles addr (2 byte), mode (as OpSetFramebuffer; entries of x, y, tile, flags)
+	OpFloodFill             // 2 byte IN; x, y (fills the 4-connected area of the color at x, y)
 )
 
+// 60 - 79 Graphics State
+const (
+	OpGetPixel      Opcode = 60 + iota // 2 byte IN; x, y; 4 byte OUT; r, g, b, a (non-alpha-premultiplied color)
+	OpGetCanvasSize                    // 4 byte OUT; w (2 byte), h (2 byte)
+	OpSetClip                          // 4 byte IN; x1, y1, x2, y2 (opposite corners, inclusive)
+	OpSetCamera                        // 4 byte IN; x (2 byte), y (2 byte) (signed; subtracted from coordinates)
+	OpNewSurface                       // 4 byte IN; w (2 byte), h (2 byte); 1 byte OUT; id (offscreen surface, or 0 if none is left)
+	OpFreeSurface                      // 1 byte IN; id
+	OpSetTarget                        // 1 byte IN; id (surface that drawing ops change; 0 = canvas; resets the clip)
+	OpCopyRect                         // 14 byte IN; src id, sx, sy, w, h, dst id, dx, dy (all but ids are 2 byte; sx, sy, dx, dy signed)
+	OpPresent                          // 1 byte IN; wait (shows the canvas from now on; non-zero waits for the next frame)
+	OpSetBlendMode                     // 1 byte IN; mode (0 = replace (default), 1 = alpha over, 2 = add, 3 = multiply, 4 = XOR)
+	OpSetConsole                       // 3 byte IN; shown, fg, bg (palette indices of the 32x24 text console over the canvas)
+	OpPrintChar                        // 1 byte IN; char (at the console cursor; '\n', '\r', '\b', '\t' and '\f' are control characters)
+	OpPrintText                        // 2 byte IN; addr (NUL-terminated string at DataSection()[addr], printed like OpPrintChar)
+	OpSetCursor                        // 2 byte IN; x, y (console cursor column and row)
+)
+
+// 80 - 99 Graphics Drawing, continued
+//
+// Drawing opcodes that no longer fit in 40 - 59, which ends with OpFloodFill at 59.
+const (
+	OpFillPolygon     Opcode = 80 + iota // 3 byte IN; addr (2 byte), n (n pairs of x, y at DataSection()[addr])
+	OpBlitTransformed                    // 13 byte IN; addr (2 byte), x, y (2 byte, signed; center), w, h, flags, key, scale (2 byte; 256 = 1x), angle (256ths of a turn, clockwise)
+)
+
+// 100 - 119 Graphics Drawing with 16-bit coordinates
+//
+// These are variants of the drawing opcodes above for canvases larger than 255x255. Every
+// coordinate, radius and corner is a signed 2 byte value, so shapes can also start above or
+// to the left of the canvas. Other arguments are the same.
+const (
+	OpSetPixel16       Opcode = 100 + iota // 4 byte IN; x, y
+	OpDrawLine16                           // 8 byte IN; x1, y1, x2, y2
+	OpDrawRect16                           // 8 byte IN; x1, y1, x2, y2
+	OpFillRect16                           // 8 byte IN; x1, y1, x2, y2
+	OpDrawEllipse16                        // 8 byte IN; x, y, rx, ry
+	OpFillEllipse16                        // 8 byte IN; x, y, rx, ry
+	OpFillTriangle16                       // 12 byte IN; x1, y1, x2, y2, x3, y3
+	OpDrawChar16                           // 5 byte IN; char, x, y
+	OpDrawText16                           // 6 byte IN; addr (2 byte), x, y
+	OpBlit16                               // 10 byte IN; addr (2 byte), x, y, w, h, flags, key
+	OpFloodFill16                          // 4 byte IN; x, y
+	OpFillPolygon16                        // 3 byte IN; addr (2 byte), n (n pairs of 2 byte x, y)
+	OpSetClip16                            // 8 byte IN; x1, y1, x2, y2
+	OpGetPixel16                           // 4 byte IN; x, y; 4 byte OUT; r, g, b, a
+	OpSetSpriteTable16                     // 5 byte IN; table addr (2 byte), tiles addr (2 byte), mode (entries of x, y, tile, flags)
+)
+
+// 120 - 139 Input
+const (
+	OpSetKeyboard Opcode = 120 + iota // 3 byte IN; addr (2 byte), enabled (key states are stored at DataSection()[addr] each frame)
+	OpSetMouse                        // 3 byte IN; addr (2 byte), enabled (mouse state is stored at DataSection()[addr] each frame)
+)
+
+// 140 - 159 Sound
+const (
+	OpSetFrequency Opcode = 140 + iota // 3 byte IN; channel, frequency (2 byte, Hz)
+	OpSetVolume                        // 2 byte IN; channel, volume
+	OpSetDuty                          // 2 byte IN; channel, duty (256ths of the period that a square wave is high)
+	OpSetWaveform                      // 2 byte IN; channel, waveform (0 = square, 1 = triangle, 2 = noise)
+	OpSetEnvelope                      // 5 byte IN; channel, attack, decay, sustain, release (times in frames; sustain is a volume)
+	OpNoteOn                           // 1 byte IN; channel (starts the attack of the envelope)
+	OpNoteOff                          // 1 byte IN; channel (starts the release of the envelope)
+	OpPlaySample                       // 8 byte IN; voice, addr (2 byte), length (2 byte), rate (2 byte, Hz), loop (8-bit unsigned PCM at DataSection()[addr])
+	OpStopSample                       // 1 byte IN; voice
+	OpPlayMusic                        // 3 byte IN; addr (2 byte), loop (song at DataSection()[addr], played by the host each frame)
+	OpStopMusic                        // (releases the notes of the music)
+	OpSetTempo                         // 1 byte IN; frames per tick of the music (6 by default)
+)
+
+// Sync reports whether the host reads the Program's memory or outputs bytes to it to handle
+// an Op with this opcode. The Program waits for Resume after sending such an Op, so that
+// its memory does not change while the host is using it.
+func (c Opcode) Sync() bool {
+	switch c {
+	case OpDrawText, OpBlit, OpGetPixel, OpGetCanvasSize, OpFillPolygon, OpNewSurface, OpPresent,
+		OpBlitTransformed, OpPrintText, OpPlaySample, OpPlayMusic,
+		OpDrawText16, OpBlit16, OpFillPolygon16, OpGetPixel16:
+		return true
+	}
+	return false
+}
+
+// Wide reports whether c is one of the variants of a drawing opcode with 16-bit
+// coordinates, which take a signed 2 byte value wherever the original takes a 1 byte one.
+func (c Opcode) Wide() bool {
+	switch c {
+	case OpSetPixel16, OpDrawLine16, OpDrawRect16, OpFillRect16, OpDrawEllipse16, OpFillEllipse16,
+		OpFillTriangle16, OpDrawChar16, OpDrawText16, OpBlit16, OpFloodFill16, OpFillPolygon16,
+		OpSetClip16, OpGetPixel16, OpSetSpriteTable16:
+		return true
+	}
+	return false
+}
+
 type Op struct {
 	Code Opcode
-	Args [8]byte
+	Args [16]byte
+}
+
+// NewOp returns an Op with the given arguments, in the order of the cells that hold them
+// below the opcode, so that the last one is Byte(0).
+func NewOp(code Opcode, args ...byte) Op {
+	op := Op{Code: code}
+	copy(op.Args[len(op.Args)-len(args):], args)
+	return op
 }
 
 // Byte returns the byte at args[-i] in Python notation.
@@ -53,13 +175,15 @@ func (op Op) Byte(i int) byte {
 	return op.Args[len(op.Args)-i-1]
 }
 
+// Word returns the big-endian word whose low byte is Byte(i).
 func (op Op) Word(i int) uint16 {
-	return uint16(op.Byte(1))<<8 | uint16(op.Byte(0))
+	return uint16(op.Byte(i+1))<<8 | uint16(op.Byte(i))
 }
 
+// QWord returns the big-endian 4 byte value whose low byte is Byte(i).
 func (op Op) QWord(i int) uint32 {
-	return uint32(op.Byte(3))<<24 | uint32(op.Byte(2))<<16 |
-		uint32(op.Byte(1))<<8 | uint32(op.Byte(0))
+	return uint32(op.Byte(i+3))<<24 | uint32(op.Byte(i+2))<<16 |
+		uint32(op.Byte(i+1))<<8 | uint32(op.Byte(i))
 }
 
 var (
@@ -67,6 +191,66 @@ var (
 	ErrCodeBracketImbalance = errors.New("brainfuck loop start/ends are out of balance")
 )
 
+// DataSize is the number of cells in the data section of a Program. It is large enough
+// for any 16-bit address that an Op may refer to.
+const DataSize = 1 << 16
+
+// Metadata returns the metadata of a cart. Metadata lines form a header at the start of the
+// cart, where each one begins with '@', directly followed by a key of letters, digits, '-'
+// or '_' and an optional value separated by whitespace, like "@size 320x240". Metadata
+// lines are not part of the program, so they may contain any characters. The header ends
+// at the first line that is neither blank nor metadata, such as "@ move right >>>", and any
+// '@' line after it is part of the program.
+func Metadata(code []byte) map[string]string {
+	meta, _ := splitMetadata(code)
+	return meta
+}
+
+// stripMetadata returns code without its metadata header.
+func stripMetadata(code []byte) []byte {
+	_, program := splitMetadata(code)
+	return program
+}
+
+// splitMetadata parses the metadata header of code and returns it with the rest of code.
+func splitMetadata(code []byte) (meta map[string]string, program []byte) {
+	meta = make(map[string]string)
+	for len(code) > 0 {
+		line := code
+		if i := bytes.IndexByte(code, '\n'); i >= 0 {
+			line = code[:i+1]
+		}
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 {
+			key, value, ok := metadataLine(trimmed)
+			if !ok {
+				break
+			}
+			meta[key] = value
+		}
+		code = code[len(line):]
+	}
+	return meta, code
+}
+
+// metadataLine parses a line of metadata, without surrounding whitespace, into its key and
+// value. ok is false if line is not metadata.
+func metadataLine(line []byte) (key, value string, ok bool) {
+	if len(line) < 2 || line[0] != '@' {
+		return "", "", false
+	}
+	k, v := line[1:], []byte(nil)
+	if i := bytes.IndexAny(k, " \t"); i >= 0 {
+		k, v = k[:i], bytes.TrimSpace(k[i:])
+	}
+	for _, c := range k {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return "", "", false
+		}
+	}
+	return string(k), string(v), len(k) > 0
+}
+
 func ValidateBrainfuck(code []byte) error {
 	depth := 0
 	for i := range code {
@@ -89,6 +273,8 @@ type Program struct {
 	memory    []byte
 	dataStart int           // Index of the data section and where memPtr starts.
 	ClockRate time.Duration // Limit the time to compute a Brainfuck instruction.
+	resume    chan []byte   // Receives the output of a Sync Op once the host has handled it.
+	mu        sync.Mutex    // Held by Run while it executes an instruction.
 	pc        int
 	r8a       byte
 	r8b       byte
@@ -100,9 +286,28 @@ type Program struct {
 	// Brainfuck program specific
 
 	memPtr int // The pointer to memory that the Brainfuck program manipulates using > and <
+
+	// Stepping, set up with Stepped
+
+	steps    int       // Instructions left in the current step, or -1 when Run is not stepped.
+	stepped  sync.Cond // Signaled by Step; its Locker is mu.
+	stepDone chan struct{}
+
+	stop    chan struct{} // Closed by Stop.
+	stopped bool
+
+	// Input and output
+
+	Input io.Reader // Read by ',' one byte at a time, giving 0 at its end; ',' does nothing when it is nil.
+
+	// Classic selects the classic Brainfuck dialect, where '.' writes the current cell to
+	// Output rather than sending an Op to the host. Nothing is written if Output is nil.
+	Classic bool
+	Output  io.Writer
 }
 
 func NewProgram(code []byte) (*Program, error) {
+	code = stripMetadata(code)
 	if err := ValidateBrainfuck(code); err != nil {
 		return nil, err
 	}
@@ -117,12 +322,16 @@ func NewProgram(code []byte) (*Program, error) {
 
 	dataStart := len(code) + 10
 	p := &Program{
-		memory:    make([]byte, dataStart+30_000),
+		memory:    make([]byte, dataStart+DataSize),
 		dataStart: dataStart,
 		pc:        0,
+		resume:    make(chan []byte),
+		stop:      make(chan struct{}),
 
 		memPtr: dataStart,
+		steps:  -1,
 	}
+	p.stepped.L = &p.mu
 	// Copy code to the beginning of the memory
 	copy(p.memory, code)
 
@@ -227,6 +436,8 @@ func (p *Program) JumpToOpenLoop() {
 	}
 }
 
+// Op handles op if it is a virtual machine operation, or sends it to the host over opChan.
+// Run calls it with the Program locked, and the lock is released while waiting on the host.
 func (p *Program) Op(op Op, opChan chan Op) {
 	switch op.Code {
 	case OpNop:
@@ -266,18 +477,93 @@ func (p *Program) Op(op Op, opChan chan Op) {
 	case OpR32BLoad:
 		p.SetQWord(p.memPtr-1, p.r32b)
 	default:
-		opChan <- op
+		p.mu.Unlock()
+		var out []byte
+		select {
+		case opChan <- op:
+			if op.Code.Sync() {
+				select {
+				case out = <-p.resume:
+				case <-p.stop:
+				}
+			}
+		case <-p.stop:
+		}
+		p.mu.Lock()
+
+		// Like the register loads, output ends in the cell right below the opcode.
+		for i, b := range out {
+			if idx := p.memPtr - len(out) + i; idx >= 0 {
+				p.SetByte(idx, b)
+			}
+		}
 	}
 }
 
+// Resume lets the Program continue after it has sent an Op whose opcode is Sync. The host
+// must call it exactly once for every such Op, after it is done with the Program's memory.
+// The bytes of out, if any, are written to the cells below the opcode, ending at memPtr-1.
+func (p *Program) Resume(out []byte) {
+	p.resume <- out
+}
+
+// Lock waits until the Program is between two instructions, then keeps it from executing
+// any more until Unlock is called. The host locks the Program to read or write its memory
+// while it is running, such as to display a memory-mapped framebuffer.
+func (p *Program) Lock() {
+	p.mu.Lock()
+}
+
+// Unlock lets a Program locked with Lock continue.
+func (p *Program) Unlock() {
+	p.mu.Unlock()
+}
+
+// Stepped makes Run execute instructions only in steps given with Step, so that a host can
+// run the Program at a speed that does not depend on the machine. Run waits for the first
+// step before it executes anything, and sends on the returned channel every time that it
+// has executed a whole step. Stepped must be called before Run.
+func (p *Program) Stepped() <-chan struct{} {
+	p.steps = 0
+	p.stepDone = make(chan struct{}, 1)
+	return p.stepDone
+}
+
+// Step lets a stepped Program execute the next n instructions. If it is waiting on the host
+// in the middle of a step, such as for Resume, what is left of that step is replaced.
+func (p *Program) Step(n int) {
+	p.mu.Lock()
+	p.steps = n
+	p.mu.Unlock()
+	p.stepped.Signal()
+}
+
+// Stop makes Run return before the next instruction, even if it is waiting on the host for
+// a step, to send an Op or for Resume. A host that stops running a Program calls Stop so
+// that Run does not wait forever. Stop must not be called more than once.
+func (p *Program) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	close(p.stop)
+	p.stepped.Signal()
+}
+
 // Run blocks the thread that the function has been called on until program termination.
 func (p *Program) Run(opChan chan Op) error {
 	if len(p.memory) == 0 {
 		return ErrProgramNoMemory
 	}
 
+	p.mu.Lock()
 	var instr byte = p.memory[p.pc]
 	for instr != 0 {
+		for p.steps == 0 && !p.stopped {
+			p.stepped.Wait() // Until the host gives the next step
+		}
+		if p.stopped {
+			break
+		}
 		start := time.Now()
 
 		switch instr {
@@ -302,7 +588,7 @@ func (p *Program) Run(opChan chan Op) error {
 			}
 			p.pc = i - 1
 
-			newVal := AddRolling(int(p.Byte(p.memPtr)), amt, 255)
+			newVal := AddRolling(int(p.Byte(p.memPtr)), amt, 256)
 			p.SetByte(p.memPtr, byte(newVal))
 		case '-':
 			var amt int
@@ -313,7 +599,7 @@ func (p *Program) Run(opChan chan Op) error {
 			}
 			p.pc = i - 1
 
-			newVal := SubRolling(int(p.Byte(p.memPtr)), amt, 255)
+			newVal := SubRolling(int(p.Byte(p.memPtr)), amt, 256)
 			p.SetByte(p.memPtr, byte(newVal))
 		case '[':
 			if bytes.Equal(p.memory[p.pc:p.pc+3], []byte("[-]")) {
@@ -328,24 +614,52 @@ func (p *Program) Run(opChan chan Op) error {
 				p.JumpToOpenLoop()
 			}
 		case '.':
-			op := Op{
-				Code: Opcode(p.Byte(p.memPtr)),
-				Args: [8]byte{},
+			if p.Classic {
+				if p.Output == nil {
+					break
+				}
+				if _, err := p.Output.Write([]byte{p.Byte(p.memPtr)}); err != nil {
+					p.mu.Unlock()
+					return err
+				}
+				break
 			}
-			argsStart := p.memPtr - 8
-			if p.memPtr-8 < 0 {
+
+			argsStart := p.memPtr - len(Op{}.Args)
+			if argsStart < 0 {
 				argsStart = 0
 			}
-			// FIXME: args are copied leaving blank space at end if argsStart = 0
-			copy(op.Args[:], p.memory[argsStart:p.memPtr])
-			p.Op(op, opChan)
+			// Byte(0) is always the cell below the opcode, even near the start of memory
+			p.Op(NewOp(Opcode(p.Byte(p.memPtr)), p.memory[argsStart:p.memPtr]...), opChan)
 		case ',':
+			if p.Input != nil {
+				// Input may wait for the user, so the host must be able to lock the Program
+				p.mu.Unlock()
+				var b [1]byte // Left as 0 at the end of the input
+				io.ReadFull(p.Input, b[:])
+				p.mu.Lock()
+				p.SetByte(p.memPtr, b[0])
+			}
 		}
 
 		// Get the next Brainfuck instruction
 		p.pc++
 		instr = p.memory[p.pc]
 
+		finished := false
+		if p.steps > 0 {
+			p.steps--
+			finished = p.steps == 0
+		}
+
+		// Give the host a chance to lock the Program between instructions
+		p.mu.Unlock()
+		if finished {
+			select {
+			case p.stepDone <- struct{}{}:
+			case <-p.stop:
+			}
+		}
 		if p.ClockRate > 1 { // If the clockRate > 1 nanosecond
 			elapsed := time.Since(start)
 			if elapsed < p.ClockRate {
@@ -354,7 +668,9 @@ func (p *Program) Run(opChan chan Op) error {
 				time.Sleep(duration)
 			}
 		}
+		p.mu.Lock()
 	}
+	p.mu.Unlock()
 
 	return nil
 }
@@ -1,6 +1,10 @@
 package vm
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
 
 func TestProgramRun(t *testing.T) {
 	table := []struct {
@@ -9,6 +13,7 @@ func TestProgramRun(t *testing.T) {
 	}{
 		{input: []byte("add 5 +++++"), wantMem: []byte{5}},
 		{input: []byte(">>>>+<-"), wantMem: []byte{0, 0, 0, 255, 1}},
+		{input: []byte("--+>-+"), wantMem: []byte{255, 0}}, // Cells wrap at 256, both ways
 		{input: []byte("+++++ +++++[>+++++ +++++<-] 100"), wantMem: []byte{0, 100}},
 		{input: []byte("+++[[>]+++++[<]>-]"), wantMem: []byte{0, 5, 5, 5}},
 
@@ -46,3 +51,215 @@ func TestProgramRun(t *testing.T) {
 		})
 	}
 }
+
+func TestProgramSync(t *testing.T) {
+	// Calls OpDrawText (50), then overwrites the opcode cell.
+	p, err := NewProgram([]byte("++++++++++ ++++++++++ ++++++++++ ++++++++++ ++++++++++.[-]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opChan := make(chan Op)
+	done := make(chan error)
+	go func() { done <- p.Run(opChan) }()
+
+	op := <-opChan
+	if op.Code != OpDrawText {
+		t.Fatalf("got %v, want %v", op.Code, OpDrawText)
+	}
+	if got := p.DataSection()[0]; got != byte(OpDrawText) {
+		t.Errorf("Program continued before Resume: DataSection()[0] = %d", got)
+	}
+	p.Resume(nil)
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if got := p.DataSection()[0]; got != 0 {
+		t.Errorf("DataSection()[0] = %d after Resume, want 0", got)
+	}
+}
+
+func TestProgramLock(t *testing.T) {
+	p, err := NewProgram([]byte("++++++++[>++++++++[>++++++++<-]<-]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Run(nil) }()
+
+	// Reading memory while locked must not race with the running Program.
+	for range 100 {
+		p.Lock()
+		_ = p.DataSection()[2]
+		p.Unlock()
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if got := p.DataSection()[1]; got != 0 {
+		t.Errorf("DataSection()[1] = %d, want 0", got)
+	}
+}
+
+func TestProgramSyncOutput(t *testing.T) {
+	// Moves right 4 cells and calls OpGetCanvasSize (61).
+	code := ">>>>" + strings.Repeat("+", int(OpGetCanvasSize)) + "."
+	p, err := NewProgram([]byte(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opChan := make(chan Op)
+	done := make(chan error)
+	go func() { done <- p.Run(opChan) }()
+
+	<-opChan
+	p.Resume([]byte{0, 255, 0, 191})
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	want := []byte{0, 255, 0, 191, byte(OpGetCanvasSize)}
+	if got := p.DataSection()[:len(want)]; !bytes.Equal(got, want) {
+		t.Errorf("DataSection()[:%d] = %v, want %v", len(want), got, want)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	code := []byte("@size 320x240\n@title  [Demo]. \n\n@empty\n+++ @ not metadata\n@after >+\n")
+	want := map[string]string{"size": "320x240", "title": "[Demo].", "empty": ""}
+
+	got := Metadata(code)
+	if len(got) != len(want) {
+		t.Errorf("Metadata(%q) = %v, want %v", code, got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Metadata(%q)[%q] = %q, want %q", code, k, got[k], v)
+		}
+	}
+
+	// The brackets and '.' of the metadata must not become part of the program, but the
+	// '@' lines after the header are
+	p, err := NewProgram(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Run(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.DataSection()[:2]; !bytes.Equal(got, []byte{3, 1}) {
+		t.Errorf("DataSection()[:2] = %v, want [3 1]", got)
+	}
+}
+
+func TestMetadataComment(t *testing.T) {
+	// An '@' that is not directly followed by a key is a comment, which ends the header
+	code := []byte("@ move right >>>\n@size 320x240\n+")
+	if got := Metadata(code); len(got) != 0 {
+		t.Errorf("Metadata(%q) = %v, want none", code, got)
+	}
+
+	p, err := NewProgram(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Run(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.DataSection()[3]; got != 1 {
+		t.Errorf("cell 3 = %d, want 1", got)
+	}
+}
+
+func TestProgramInput(t *testing.T) {
+	// Read two characters and add them together; the third ',' is at the end of the input,
+	// where it stores 0 over the 1.
+	p, err := NewProgram([]byte(",>,[<+>-]+,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Input = strings.NewReader("\x02\x03")
+	if err = p.Run(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.DataSection()[:2]; !bytes.Equal(got, []byte{5, 0}) {
+		t.Errorf("cells = %v, want [5 0]", got)
+	}
+}
+
+func TestProgramClassic(t *testing.T) {
+	table := []struct {
+		name, code, input, want string
+	}{
+		{
+			name: "hello",
+			code: "++++++++[>++++[>++>+++>+++>+<<<<-]>+>+>->>+[<]<-]>>.>---.+++++++..+++.>>.<-.<.+++.------.--------.>>+.>++.",
+			want: "Hello World!\n",
+		},
+		{name: "cat", code: ",[.,]", input: "echo", want: "echo"},
+		{name: "wrap", code: "-.+.", want: "\xff\x00"},
+		{name: "metadata", code: "@title [Demo].\n+++.", want: "\x03"},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := NewProgram([]byte(test.code))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			p.Classic = true
+			p.Input, p.Output = strings.NewReader(test.input), &out
+
+			// No Op may be sent to the host
+			opChan := make(chan Op)
+			if err = p.Run(opChan); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("output = %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestProgramStepped(t *testing.T) {
+	// Counts up in cell 1 forever, four instructions per iteration, without sending an Op.
+	p, err := NewProgram([]byte("+[>+<]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepped := p.Stepped()
+	returned := make(chan error)
+	go func() { returned <- p.Run(nil) }()
+
+	for _, step := range []struct{ n, want int }{{10, 2}, {40, 12}, {1, 12}, {3, 13}} {
+		p.Step(step.n)
+		<-stepped
+		p.Lock()
+		got := p.DataSection()[1]
+		p.Unlock()
+		if int(got) != step.want {
+			t.Errorf("cell 1 = %d after a step of %d, want %d", got, step.n, step.want)
+		}
+	}
+
+	// Run waits for the next step until the Program is stopped
+	p.Stop()
+	if err := <-returned; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpcodeWide(t *testing.T) {
+	// Every opcode with 16-bit coordinates is named after its 8-bit original
+	for c := range Opcode(255) {
+		if want := strings.HasSuffix(c.String(), "16"); c.Wide() != want {
+			t.Errorf("%v.Wide() = %t, want %t", c, c.Wide(), want)
+		}
+	}
+}